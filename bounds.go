@@ -0,0 +1,117 @@
+package geoolocation
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// countryBoundsTable is the table of the bounding boxes of the countries, by code.
+// A box whose west is greater than its east crosses the antimeridian.
+//
+//go:embed data/country-bounds.csv
+var countryBoundsTable string
+
+// bounds is a bounding box in degrees.
+type bounds struct {
+	south, west, north, east float64
+}
+
+// countryBounds maps the codes to the bounding boxes of the countries.
+var countryBounds = make(map[string]bounds)
+
+func init() {
+	for _, record := range readTable(countryBoundsTable) {
+		var b bounds
+		for j, f := range []*float64{&b.south, &b.west, &b.north, &b.east} {
+			v, err := strconv.ParseFloat(record[j+1], 64)
+			if err != nil {
+				panic(fmt.Sprintf("invalid bounds of %s: %v", record[0], err))
+			}
+			*f = v
+		}
+
+		countryBounds[record[0]] = b
+	}
+}
+
+// contains reports whether the box, widened by tolerance degrees on every side,
+// contains the point.
+func (b bounds) contains(latitude float64, longitude float64, tolerance float64) bool {
+	if latitude < b.south-tolerance || latitude > b.north+tolerance {
+		return false
+	}
+
+	if b.west <= b.east {
+		return b.west-tolerance <= longitude && longitude <= b.east+tolerance
+	}
+
+	return longitude >= b.west-tolerance || longitude <= b.east+tolerance
+}
+
+// The names of the coordinate plausibility rules.
+const (
+	RuleCoordinates = "coordinates"
+	RuleNullIsland  = "null island"
+)
+
+// parseCoordinates returns the latitude and longitude of the row.
+func parseCoordinates(row *Row) (float64, float64, error) {
+	latitude, err := strconv.ParseFloat(row.Latitude, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	longitude, err := strconv.ParseFloat(row.Longitude, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return latitude, longitude, nil
+}
+
+// CoordinatesRule returns the coordinates rule, which checks the latitude and
+// longitude fall inside the bounding box of the country code, embedded in
+// data/country-bounds.csv. The boxes are rounded to about a tenth of a degree, so
+// tolerance, in degrees, widens them on every side. The rows with a code without a
+// box, such as EU, are accepted. The rule isn't one of the default rules:
+//
+//	AddRules: []Rule{CoordinatesRule(0.5), NullIslandRule()}
+func CoordinatesRule(tolerance float64) Rule {
+	return NewRule(RuleCoordinates, func(row *Row) error {
+		b, ok := countryBounds[normalizeCountryCode(row.CountryCode)]
+		if !ok {
+			return nil
+		}
+
+		latitude, longitude, err := parseCoordinates(row)
+		if err != nil {
+			return err
+		}
+
+		if !b.contains(latitude, longitude, tolerance) {
+			return fmt.Errorf("(%v, %v) is outside %s", latitude, longitude, normalizeCountryCode(row.CountryCode))
+		}
+
+		return nil
+	})
+}
+
+// NullIslandRule returns the null island rule, which rejects the (0, 0)
+// coordinates, the placeholder of an unknown location. The rule isn't one of the
+// default rules.
+func NullIslandRule() Rule {
+	return NewRule(RuleNullIsland, func(row *Row) error {
+		latitude, longitude, err := parseCoordinates(row)
+		if err != nil {
+			return err
+		}
+
+		if latitude == 0 && longitude == 0 {
+			return errors.New("(0, 0) is a placeholder")
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,91 @@
+package geoolocation
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type BoundsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *BoundsTestSuite) TestBounds_countryBounds() {
+	require := suite.Require()
+
+	// Every assigned code has a box.
+	for code := range countryNames {
+		_, ok := countryBounds[code]
+		require.True(ok, code)
+	}
+
+	for code, b := range countryBounds {
+		require.True(b.south < b.north, code)
+	}
+}
+
+func (suite *BoundsTestSuite) TestBounds_CoordinatesRule() {
+	require := suite.Require()
+
+	tests := []struct {
+		desc      string
+		tolerance float64
+		code      string
+		latitude  string
+		longitude string
+		valid     bool
+	}{
+		{"Inside", 0, "CZ", "50.0755", "14.4378", true},
+		{"Lower case code", 0, "cz ", "50.0755", "14.4378", true},
+		{"Outside", 0, "CZ", "48.8566", "2.3522", false},
+		{"Outside the box", 0, "CZ", "51.2", "14.4378", false},
+		{"Within the tolerance", 0.5, "CZ", "51.2", "14.4378", true},
+		{"Across the antimeridian, east", 0, "US", "52.9", "173.2", true},
+		{"Across the antimeridian, west", 0, "NZ", "-43.9", "-176.5", true},
+		{"Outside across the antimeridian", 0, "NZ", "-43.9", "-170", false},
+		{"Code without a box", 0, "EU", "0", "0", true},
+		{"Invalid latitude", 0, "CZ", "north", "14.4378", false},
+	}
+
+	for _, t := range tests {
+		suite.Run(t.desc, func() {
+			rule := CoordinatesRule(t.tolerance)
+			err := rule.Validate(&Row{CountryCode: t.code, Latitude: t.latitude, Longitude: t.longitude})
+			require.Equal(t.valid, err == nil)
+			require.Equal(RuleCoordinates, rule.Name())
+		})
+	}
+}
+
+func (suite *BoundsTestSuite) TestBounds_NullIslandRule() {
+	require := suite.Require()
+
+	rule := NullIslandRule()
+	require.Error(rule.Validate(&Row{Latitude: "0", Longitude: "0.000"}))
+	require.NoError(rule.Validate(&Row{Latitude: "0", Longitude: "0.001"}))
+	require.NoError(rule.Validate(&Row{Latitude: "-0.001", Longitude: "0"}))
+	require.Error(rule.Validate(&Row{Latitude: "0", Longitude: "east"}))
+	require.Equal(RuleNullIsland, rule.Name())
+}
+
+func (suite *BoundsTestSuite) TestBounds_ImportReader_Success() {
+	require := suite.Require()
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"200.106.141.15,CZ,Czechia,Prague,50.0755,14.4378,7823011346\n" +
+		"160.103.7.140,CZ,Czechia,Prague,48.8566,2.3522,7301823115\n" +
+		"70.95.73.73,GH,Ghana,Accra,0,0,2559997162\n"
+
+	result, err := new(Geo).ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		DryRun:   true,
+		AddRules: []Rule{NullIslandRule(), CoordinatesRule(0.5)},
+	})
+	require.NoError(err)
+	require.Equal(int64(1), result.AcceptedRows)
+	require.Equal(map[string]int64{"invalid coordinates": 1, "invalid null island": 1}, result.Rejected)
+}
+
+func TestBounds(t *testing.T) {
+	suite.Run(t, new(BoundsTestSuite))
+}
@@ -0,0 +1,141 @@
+package geoolocation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"github.com/zeynab-sb/geoolocation/database"
+	"io"
+)
+
+// defaultCheckpointRows is the number of rows read between checkpoints by default.
+const defaultCheckpointRows = 100000
+
+// CheckpointOptions makes an import resumable. The rows are loaded in chunks, and
+// every chunk is committed together with a checkpoint of the position of the source
+// following it, so an import that dies can be resumed from the last checkpoint
+// without loading any row twice. The checkpoints are saved in the
+// import_checkpoints table, which is created if it doesn't exist, and the checkpoint
+// of an import is removed once it's done. It's only supported in append mode.
+type CheckpointOptions struct {
+	// Name identifies the import, the path of the file by default. It's required
+	// when importing from a reader.
+	Name string
+
+	// The number of rows read between checkpoints, 100000 by default.
+	Rows int64
+
+	// Resume continues the import from its last checkpoint, if there is one. The
+	// source must be the same, and the Result only covers the rows after the
+	// checkpoint.
+	Resume bool
+}
+
+// checkpointName returns the name of the checkpoints of the import.
+func checkpointName(path string, opts *CheckpointOptions) (string, error) {
+	if opts.Name != "" {
+		return opts.Name, nil
+	}
+
+	if path == "" {
+		return "", errors.New("checkpoint name is required when importing from a reader")
+	}
+
+	return path, nil
+}
+
+// saveCheckpoint waits for the sanitizers to finish the rows sent so far, and loads
+// the sanitized file together with the checkpoint of the current position.
+func (i *csvImporter) saveCheckpoint(ctx context.Context) error {
+	i.pending.Wait()
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.writer.Flush()
+	if err := i.writer.Error(); err != nil {
+		return err
+	}
+
+	checkpoint := i.position
+	checkpoint.Loaded = i.checkpoint.Loaded
+
+	opts := *i.loadOptions
+	opts.Checkpoint = &checkpoint
+	loaded, err := i.driver.Load(ctx, i.sanitizedPath, &opts)
+	if err != nil {
+		return err
+	}
+
+	i.loaded.Inserted += loaded.Inserted
+	checkpoint.Loaded += loaded.Inserted
+	i.checkpoint = &checkpoint
+	logrus.Infof("checkpoint saved: %s at line %d, %d rows loaded", checkpoint.Name, checkpoint.Line, checkpoint.Loaded)
+
+	return nil
+}
+
+// nextChunk empties the sanitized file after a checkpoint for the next chunk of rows.
+func (i *csvImporter) nextChunk() error {
+	if err := i.sanitizedFile.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err := i.sanitizedFile.Seek(0, io.SeekStart)
+
+	return err
+}
+
+// skipSource discards n bytes of r and returns the number of lines in them.
+func skipSource(r *bufio.Reader, n int64) (int64, error) {
+	var lines int64
+	for n > 0 {
+		size := int64(r.Size())
+		if size > n {
+			size = n
+		}
+
+		b, err := r.Peek(int(size))
+		lines += int64(bytes.Count(b, []byte{'\n'}))
+		if _, err := r.Discard(len(b)); err != nil {
+			return 0, err
+		}
+		n -= int64(len(b))
+
+		if err == io.EOF {
+			return 0, errors.New("checkpoint is past the end of the source")
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return lines, nil
+}
+
+// clearCheckpoint removes the checkpoint of a finished import. The rows are loaded
+// already, so a failure is only logged.
+func (i *csvImporter) clearCheckpoint(ctx context.Context) {
+	if err := i.driver.ClearCheckpoint(ctx, i.checkpoint.Name); err != nil {
+		logrus.Errorf("error clearing checkpoint: %v", err)
+	}
+}
+
+// resumeCheckpoint returns the checkpoint the import starts from, a new one unless
+// it's resumed from a saved one.
+func resumeCheckpoint(ctx context.Context, driver database.Driver, name string, resume bool) (*database.Checkpoint, error) {
+	saved, err := driver.Checkpoint(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resume || saved == nil {
+		return &database.Checkpoint{Name: name}, nil
+	}
+
+	logrus.Infof("resuming %s from line %d, %d rows loaded", name, saved.Line, saved.Loaded)
+
+	return saved, nil
+}
@@ -0,0 +1,182 @@
+package geoolocation
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"github.com/zeynab-sb/geoolocation/database"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type CheckpointTestSuite struct {
+	suite.Suite
+	db      *sql.DB
+	sqlMock sqlmock.Sqlmock
+	geo     Geo
+}
+
+// checkpointTestHeader and checkpointTestRows are the source of the checkpointed
+// imports, the third row has an invalid ip.
+var checkpointTestHeader = "ip_address,country_code,country,city,latitude,longitude,mystery_value\n"
+var checkpointTestRows = []string{
+	"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n",
+	"127.0.0.2,US,test,test,48.92021642445653,14.900399560492929,2147483647\n",
+	"test,US,test,test,48.92021642445653,14.900399560492929,2147483647\n",
+	"127.0.0.4,US,test,test,48.92021642445653,14.900399560492929,2147483647\n",
+}
+
+func (suite *CheckpointTestSuite) SetupTest() {
+	mockDB, sqlMock, err := sqlmock.New()
+	suite.Require().NoError(err)
+
+	suite.db = mockDB
+	suite.sqlMock = sqlMock
+	suite.geo = Geo{db: mockDB, driver: &database.MySQLDriver{DB: mockDB}}
+}
+
+func (suite *CheckpointTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.sqlMock.ExpectationsWereMet())
+	_ = suite.db.Close()
+}
+
+// offset returns the offset of the source following the first n rows.
+func (suite *CheckpointTestSuite) offset(n int) int64 {
+	return int64(len(checkpointTestHeader + strings.Join(checkpointTestRows[:n], "")))
+}
+
+func (suite *CheckpointTestSuite) expectCheckpoint(rows *sqlmock.Rows) {
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS import_checkpoints")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT source_offset, line, rows_read, rows_loaded FROM import_checkpoints WHERE name = ?")).
+		WithArgs("data").
+		WillReturnRows(rows)
+}
+
+func (suite *CheckpointTestSuite) expectLoad(inserted int64, args ...driver.Value) {
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(inserted, inserted))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO import_checkpoints (name, source_offset, line, rows_read, rows_loaded) VALUES")).
+		WithArgs(args...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+}
+
+func (suite *CheckpointTestSuite) TestCheckpoint_ImportReader_Success() {
+	require := suite.Require()
+	expectedResult := &Result{
+		TotalRows:     4,
+		AcceptedRows:  3,
+		InsertedRows:  3,
+		DiscardedRows: 1,
+		Rejected:      map[string]int64{"invalid ip": 1},
+	}
+
+	suite.expectCheckpoint(sqlmock.NewRows([]string{"source_offset", "line", "rows_read", "rows_loaded"}))
+	suite.expectLoad(2, "data", suite.offset(2), 3, 2, 2)
+	suite.expectLoad(1, "data", suite.offset(4), 5, 4, 3)
+	suite.expectLoad(0, "data", suite.offset(4), 5, 4, 3)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM import_checkpoints WHERE name = ?")).
+		WithArgs("data").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	source := strings.NewReader(checkpointTestHeader + strings.Join(checkpointTestRows, ""))
+	result, err := suite.geo.ImportReader(context.Background(), source, &ImportOptions{
+		Concurrency: 2,
+		Checkpoint:  &CheckpointOptions{Name: "data", Rows: 2},
+	})
+	require.NoError(err)
+
+	expectedResult.TimeTaken = result.TimeTaken
+	require.Equal(expectedResult, result)
+}
+
+func (suite *CheckpointTestSuite) TestCheckpoint_ImportReader_Resume_Success() {
+	require := suite.Require()
+	expectedResult := &Result{
+		TotalRows:     2,
+		AcceptedRows:  1,
+		InsertedRows:  1,
+		DiscardedRows: 1,
+		Rejected:      map[string]int64{"invalid ip": 1},
+	}
+	expectedRows := []RejectedRow{
+		{Line: 4, Record: strings.Split(strings.TrimSpace(checkpointTestRows[2]), ","), Reason: "invalid ip"},
+	}
+
+	suite.expectCheckpoint(sqlmock.NewRows([]string{"source_offset", "line", "rows_read", "rows_loaded"}).
+		AddRow(suite.offset(2), 3, 2, 2))
+	suite.expectLoad(1, "data", suite.offset(4), 5, 4, 3)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM import_checkpoints WHERE name = ?")).
+		WithArgs("data").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var rows []RejectedRow
+	source := strings.NewReader(checkpointTestHeader + strings.Join(checkpointTestRows, ""))
+	result, err := suite.geo.ImportReader(context.Background(), source, &ImportOptions{
+		Checkpoint: &CheckpointOptions{Name: "data", Resume: true},
+		OnReject:   func(row RejectedRow) { rows = append(rows, row) },
+	})
+	require.NoError(err)
+
+	expectedResult.TimeTaken = result.TimeTaken
+	require.Equal(expectedResult, result)
+	require.Equal(expectedRows, rows)
+}
+
+func (suite *CheckpointTestSuite) TestCheckpoint_ImportReader_PastEnd_Failure() {
+	require := suite.Require()
+	expectedError := "checkpoint is past the end of the source"
+
+	suite.expectCheckpoint(sqlmock.NewRows([]string{"source_offset", "line", "rows_read", "rows_loaded"}).
+		AddRow(suite.offset(4)+1, 5, 4, 4))
+
+	source := strings.NewReader(checkpointTestHeader + strings.Join(checkpointTestRows, ""))
+	_, err := suite.geo.ImportReader(context.Background(), source, &ImportOptions{
+		Checkpoint: &CheckpointOptions{Name: "data", Resume: true},
+	})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *CheckpointTestSuite) TestCheckpoint_ImportReader_NoName_Failure() {
+	require := suite.Require()
+	expectedError := "checkpoint name is required when importing from a reader"
+
+	_, err := suite.geo.ImportReader(context.Background(), strings.NewReader(checkpointTestHeader), &ImportOptions{
+		Checkpoint: &CheckpointOptions{},
+	})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *CheckpointTestSuite) TestCheckpoint_ImportReader_Mode_Failure() {
+	require := suite.Require()
+	expectedError := "checkpoints are only supported in append mode"
+
+	_, err := suite.geo.ImportReader(context.Background(), strings.NewReader(checkpointTestHeader), &ImportOptions{
+		Mode:       database.ModeUpsert,
+		Checkpoint: &CheckpointOptions{Name: "data"},
+	})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *CheckpointTestSuite) TestCheckpoint_skipSource() {
+	require := suite.Require()
+
+	r := bufio.NewReaderSize(strings.NewReader("a\nb\nc\nd"), 16)
+	lines, err := skipSource(r, 4)
+	require.NoError(err)
+	require.Equal(int64(2), lines)
+
+	rest, err := r.ReadString(0)
+	require.Equal("c\nd", rest)
+	require.EqualError(err, "EOF")
+}
+
+func TestCheckpoint(t *testing.T) {
+	suite.Run(t, new(CheckpointTestSuite))
+}
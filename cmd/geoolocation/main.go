@@ -0,0 +1,173 @@
+// Command geoolocation runs the long-running imports of the library.
+//
+// Usage:
+//
+//	geoolocation watch -config db.yaml -dir /srv/drop [flags]
+//	geoolocation fetch -config db.yaml -url https://example.com/data.csv [flags]
+//
+// The config file holds the database.DBConfig as YAML.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/zeynab-sb/geoolocation"
+	"github.com/zeynab-sb/geoolocation/database"
+	"gopkg.in/yaml.v3"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// modes are the values of the -mode flag.
+var modes = map[string]database.Mode{
+	"append":  database.ModeAppend,
+	"replace": database.ModeReplace,
+	"upsert":  database.ModeUpsert,
+	"delta":   database.ModeDelta,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "watch":
+		err = watch(ctx, os.Args[2:])
+	case "fetch":
+		err = fetch(ctx, os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logrus.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: geoolocation watch -config db.yaml -dir DIR [flags]")
+	fmt.Fprintln(os.Stderr, "       geoolocation fetch -config db.yaml -url URL [flags]")
+	os.Exit(2)
+}
+
+// importFlags are the flags configuring the imports of every command.
+type importFlags struct {
+	config      *string
+	concurrency *uint
+	mode        *string
+	dryRun      *bool
+}
+
+func newImportFlags(flags *flag.FlagSet) *importFlags {
+	return &importFlags{
+		config:      flags.String("config", "", "the YAML database config"),
+		concurrency: flags.Uint("concurrency", 1, "the number of concurrent sanitizers"),
+		mode:        flags.String("mode", "append", "append, replace, upsert or delta"),
+		dryRun:      flags.Bool("dry-run", false, "sanitize the files without loading them"),
+	}
+}
+
+// geo returns the Geo importing into the database of the config file, and the
+// options of the imports.
+func (f *importFlags) geo() (*geoolocation.Geo, *geoolocation.ImportOptions, error) {
+	mode, ok := modes[*f.mode]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid mode %q", *f.mode)
+	}
+
+	opts := &geoolocation.ImportOptions{Concurrency: *f.concurrency, Mode: mode, DryRun: *f.dryRun}
+	if *f.dryRun {
+		return new(geoolocation.Geo), opts, nil
+	}
+
+	geo, err := newGeo(*f.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return geo, opts, nil
+}
+
+// watch imports the files dropped into a directory until it's interrupted.
+func watch(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	importFlags := newImportFlags(flags)
+	dir := flags.String("dir", "", "the directory to watch")
+	interval := flags.Duration("interval", 0, "how often the directory is listed (default 10s)")
+	processed := flags.String("processed", "", "where the imported files are moved (default DIR/processed)")
+	failed := flags.String("failed", "", "where the files failed to be imported are moved (default DIR/failed)")
+	_ = flags.Parse(args)
+
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+
+	geo, opts, err := importFlags.geo()
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("watching %s", *dir)
+
+	return geo.Watch(ctx, *dir, &geoolocation.WatchOptions{
+		PollInterval: *interval,
+		ProcessedDir: *processed,
+		FailedDir:    *failed,
+		Import:       opts,
+	})
+}
+
+// fetch imports the file at a url every interval until it's interrupted.
+func fetch(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	importFlags := newImportFlags(flags)
+	rawURL := flags.String("url", "", "the url of the CSV")
+	interval := flags.Duration("interval", 0, "how often the url is fetched (default 1h)")
+	retries := flags.Int("retries", 0, "how many times a failed request is retried (default 3)")
+	_ = flags.Parse(args)
+
+	if *rawURL == "" {
+		return errors.New("-url is required")
+	}
+
+	geo, opts, err := importFlags.geo()
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("fetching %s", *rawURL)
+
+	return geo.ScheduleFetch(ctx, *rawURL, &geoolocation.FetchOptions{
+		Retries:  *retries,
+		Interval: *interval,
+		Import:   opts,
+	})
+}
+
+// newGeo connects to the database of the config file.
+func newGeo(path string) (*geoolocation.Geo, error) {
+	if path == "" {
+		return nil, errors.New("-config is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config database.DBConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return geoolocation.New(&config)
+}
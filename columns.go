@@ -0,0 +1,135 @@
+package geoolocation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ColumnMapping tells where the fields of a location are found in the source. The
+// fields are named like the default header: ip_address, country_code, country, city,
+// latitude, longitude and mystery_value, followed by operation in a delta import.
+// Every field must be found, and the other columns of the source are ignored.
+type ColumnMapping struct {
+	// Names maps a field to the header names accepted for it, in addition to the
+	// field name itself and DefaultHeaderAliases. Case and surrounding spaces are
+	// ignored.
+	Names map[string][]string
+
+	// Indexes maps a field to its zero-based column index. It takes precedence over
+	// the header names.
+	Indexes map[string]int
+
+	// NoHeader tells that the first row is data, so every field must be in Indexes.
+	NoHeader bool
+}
+
+// DefaultHeaderAliases are the header names accepted for the fields when a
+// ColumnMapping is used, in addition to the field names.
+var DefaultHeaderAliases = map[string][]string{
+	"ip_address":    {"ip", "ip_addr", "ipaddress"},
+	"country_code":  {"cc", "iso_code", "countrycode"},
+	"country":       {"country_name"},
+	"city":          {"city_name"},
+	"latitude":      {"lat"},
+	"longitude":     {"lon", "lng", "long"},
+	"mystery_value": {"mystery"},
+	"operation":     {"op", "action"},
+}
+
+// resolveColumns returns the column index of every one of the fields. Without a
+// mapping the header must be exactly the fields.
+func resolveColumns(header []string, fields []string, mapping *ColumnMapping) ([]int, error) {
+	columns := make([]int, len(fields))
+
+	if mapping == nil {
+		if len(header) != len(fields) {
+			return nil, errors.New("invalid csv header")
+		}
+
+		for j := range fields {
+			if header[j] != fields[j] {
+				return nil, errors.New("invalid csv header")
+			}
+			columns[j] = j
+		}
+
+		return columns, nil
+	}
+
+	for field := range mapping.Names {
+		if fieldIndex(fields, field) < 0 {
+			return nil, fmt.Errorf("invalid column mapping: unknown field %s", field)
+		}
+	}
+
+	for field := range mapping.Indexes {
+		if fieldIndex(fields, field) < 0 {
+			return nil, fmt.Errorf("invalid column mapping: unknown field %s", field)
+		}
+	}
+
+	for j, field := range fields {
+		if index, ok := mapping.Indexes[field]; ok {
+			if index < 0 {
+				return nil, fmt.Errorf("invalid column mapping: negative index for %s", field)
+			}
+
+			columns[j] = index
+			continue
+		}
+
+		if mapping.NoHeader {
+			return nil, fmt.Errorf("invalid column mapping: no index for %s", field)
+		}
+
+		index, err := headerIndex(header, field, mapping.Names[field])
+		if err != nil {
+			return nil, err
+		}
+		columns[j] = index
+	}
+
+	return columns, nil
+}
+
+// headerIndex finds the column of the field by its name or one of its aliases.
+func headerIndex(header []string, field string, names []string) (int, error) {
+	accepted := map[string]bool{field: true}
+	for _, name := range append(names, DefaultHeaderAliases[field]...) {
+		accepted[normalizeHeader(name)] = true
+	}
+
+	index := -1
+	for j, name := range header {
+		if !accepted[normalizeHeader(name)] {
+			continue
+		}
+
+		if index >= 0 {
+			return 0, fmt.Errorf("invalid csv header: more than one %s column", field)
+		}
+		index = j
+	}
+
+	if index < 0 {
+		return 0, fmt.Errorf("invalid csv header: missing %s column", field)
+	}
+
+	return index, nil
+}
+
+func normalizeHeader(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// fieldIndex returns the position of the field in fields, -1 if it's unknown.
+func fieldIndex(fields []string, field string) int {
+	for j, f := range fields {
+		if f == field {
+			return j
+		}
+	}
+
+	return -1
+}
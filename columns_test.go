@@ -0,0 +1,119 @@
+package geoolocation
+
+import (
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type ColumnsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ColumnsTestSuite) TestColumns_resolveColumns() {
+	require := suite.Require()
+
+	tests := []struct {
+		desc            string
+		header          []string
+		mapping         *ColumnMapping
+		expectedColumns []int
+		expectedError   string
+	}{
+		{
+			"Default header",
+			[]string{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
+			nil,
+			[]int{0, 1, 2, 3, 4, 5, 6},
+			"",
+		},
+		{
+			"Reordered header without mapping",
+			[]string{"country_code", "ip_address", "country", "city", "latitude", "longitude", "mystery_value"},
+			nil,
+			nil,
+			"invalid csv header",
+		},
+		{
+			"Reordered header with aliases and extra columns",
+			[]string{"extra", "Lon", "LAT", "city", "country", " cc ", "ip", "mystery_value"},
+			&ColumnMapping{},
+			[]int{6, 5, 4, 3, 2, 1, 7},
+			"",
+		},
+		{
+			"Custom names",
+			[]string{"addr", "code", "country", "town", "y", "x", "score"},
+			&ColumnMapping{Names: map[string][]string{
+				"ip_address":    {"addr"},
+				"country_code":  {"code"},
+				"city":          {"town"},
+				"latitude":      {"y"},
+				"longitude":     {"x"},
+				"mystery_value": {"score"},
+			}},
+			[]int{0, 1, 2, 3, 4, 5, 6},
+			"",
+		},
+		{
+			"Indexes take precedence over names",
+			[]string{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value", "city_ascii"},
+			&ColumnMapping{Indexes: map[string]int{"city": 7}},
+			[]int{0, 1, 2, 7, 4, 5, 6},
+			"",
+		},
+		{
+			"No header",
+			nil,
+			&ColumnMapping{NoHeader: true, Indexes: map[string]int{
+				"ip_address": 6, "country_code": 5, "country": 4, "city": 3, "latitude": 2, "longitude": 1, "mystery_value": 0,
+			}},
+			[]int{6, 5, 4, 3, 2, 1, 0},
+			"",
+		},
+		{
+			"No header without all indexes",
+			nil,
+			&ColumnMapping{NoHeader: true, Indexes: map[string]int{"ip_address": 0}},
+			nil,
+			"invalid column mapping: no index for country_code",
+		},
+		{
+			"Unknown field",
+			[]string{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
+			&ColumnMapping{Names: map[string][]string{"zip": {"postal_code"}}},
+			nil,
+			"invalid column mapping: unknown field zip",
+		},
+		{
+			"Missing column",
+			[]string{"ip_address", "country_code", "country", "city", "latitude", "mystery_value"},
+			&ColumnMapping{},
+			nil,
+			"invalid csv header: missing longitude column",
+		},
+		{
+			"Ambiguous column",
+			[]string{"ip_address", "country_code", "country", "city", "latitude", "lng", "lon", "mystery_value"},
+			&ColumnMapping{},
+			nil,
+			"invalid csv header: more than one longitude column",
+		},
+	}
+
+	for _, t := range tests {
+		suite.Run(t.desc, func() {
+			columns, err := resolveColumns(t.header, csvHeader, t.mapping)
+			if t.expectedError != "" {
+				require.EqualError(err, t.expectedError)
+				return
+			}
+
+			require.NoError(err)
+			require.Equal(t.expectedColumns, columns)
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	suite.Run(t, new(ColumnsTestSuite))
+}
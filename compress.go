@@ -0,0 +1,187 @@
+package geoolocation
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/zeynab-sb/geoolocation/internal/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compression is the format an import source is compressed with.
+type compression int
+
+const (
+	compressionNone compression = iota
+	compressionGzip
+	compressionZstd
+	compressionZip
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte{0x50, 0x4b, 0x03, 0x04}
+)
+
+// compressionByExt detects the compression by the extension of the path.
+func compressionByExt(path string) compression {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return compressionGzip
+	case ".zst":
+		return compressionZstd
+	case ".zip":
+		return compressionZip
+	}
+
+	return compressionNone
+}
+
+// compressionByMagic detects the compression by the first bytes of the stream.
+func compressionByMagic(head []byte) compression {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return compressionGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return compressionZstd
+	case bytes.HasPrefix(head, zipMagic):
+		return compressionZip
+	}
+
+	return compressionNone
+}
+
+// decompress returns a reader of the uncompressed content of source. The compression
+// is detected by the extension of path, and if it doesn't tell, by the magic bytes.
+// A zip archive must contain exactly one file. The returned reader must be closed.
+func decompress(path string, source io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(source)
+
+	c := compressionByExt(path)
+	if c == compressionNone {
+		head, err := buffered.Peek(len(zipMagic))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		c = compressionByMagic(head)
+	}
+
+	switch c {
+	case compressionGzip:
+		return gzip.NewReader(buffered)
+	case compressionZstd:
+		return io.NopCloser(zstd.NewReader(buffered)), nil
+	case compressionZip:
+		// Reading a zip archive needs random access. A file can be used directly,
+		// any other stream is copied to a temporary file first.
+		if ra, size, ok := randomAccess(source); ok {
+			return openZipEntry(ra, size, nil)
+		}
+
+		tmp, err := os.CreateTemp("", "geoolocation_*.zip")
+		if err != nil {
+			return nil, err
+		}
+
+		remove := func() error {
+			_ = tmp.Close()
+			return os.Remove(tmp.Name())
+		}
+
+		if _, err := io.Copy(tmp, buffered); err != nil {
+			_ = remove()
+			return nil, err
+		}
+
+		info, err := tmp.Stat()
+		if err != nil {
+			_ = remove()
+			return nil, err
+		}
+
+		r, err := openZipEntry(tmp, info.Size(), remove)
+		if err != nil {
+			_ = remove()
+			return nil, err
+		}
+
+		return r, nil
+	}
+
+	return io.NopCloser(buffered), nil
+}
+
+// randomAccess returns source as an io.ReaderAt with its size, if the source is a
+// regular file, optionally wrapped to count the bytes read.
+func randomAccess(source io.Reader) (io.ReaderAt, int64, bool) {
+	switch s := source.(type) {
+	case *os.File:
+		info, err := s.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil, 0, false
+		}
+
+		return s, info.Size(), true
+	case *countingReader:
+		if _, size, ok := randomAccess(s.r); ok {
+			return s, size, true
+		}
+	}
+
+	return nil, 0, false
+}
+
+// openZipEntry opens the only file in the zip archive. cleanup, if not nil, is called
+// when the returned reader is closed.
+func openZipEntry(ra io.ReaderAt, size int64, cleanup func() error) (io.ReadCloser, error) {
+	archive, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *zip.File
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if entry != nil {
+			return nil, errors.New("zip archive must contain exactly one file")
+		}
+		entry = f
+	}
+
+	if entry == nil {
+		return nil, errors.New("zip archive must contain exactly one file")
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipEntryReader{ReadCloser: rc, cleanup: cleanup}, nil
+}
+
+type zipEntryReader struct {
+	io.ReadCloser
+	cleanup func() error
+}
+
+func (r *zipEntryReader) Close() error {
+	err := r.ReadCloser.Close()
+	if r.cleanup != nil {
+		if cErr := r.cleanup(); err == nil {
+			err = cErr
+		}
+	}
+
+	return err
+}
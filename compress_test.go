@@ -0,0 +1,145 @@
+package geoolocation
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+const compressTestCSV = "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+	"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+	"test,test,test,test,test,test,test\n"
+
+type CompressTestSuite struct {
+	suite.Suite
+}
+
+func gzipBytes(data string) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+
+	return b.Bytes()
+}
+
+func zipBytes(files map[string]string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, data := range files {
+		f, _ := w.Create(name)
+		_, _ = f.Write([]byte(data))
+	}
+	_ = w.Close()
+
+	return b.Bytes()
+}
+
+func (suite *CompressTestSuite) readAll(path string, source io.Reader) (string, error) {
+	r, err := decompress(path, source)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+
+	return string(data), err
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_Plain_Success() {
+	require := suite.Require()
+
+	data, err := suite.readAll("data.csv", strings.NewReader(compressTestCSV))
+	require.NoError(err)
+	require.Equal(compressTestCSV, data)
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_GzipMagic_Success() {
+	require := suite.Require()
+
+	data, err := suite.readAll("", bytes.NewReader(gzipBytes(compressTestCSV)))
+	require.NoError(err)
+	require.Equal(compressTestCSV, data)
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_Zstd_Success() {
+	require := suite.Require()
+
+	file, err := os.Open("testdata/data.csv.zst")
+	require.NoError(err)
+	defer file.Close()
+
+	data, err := suite.readAll("", file)
+	require.NoError(err)
+	require.Equal(compressTestCSV, data)
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_ZipStream_Success() {
+	require := suite.Require()
+
+	data, err := suite.readAll("", bytes.NewReader(zipBytes(map[string]string{"data.csv": compressTestCSV})))
+	require.NoError(err)
+	require.Equal(compressTestCSV, data)
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_ZipFile_Success() {
+	require := suite.Require()
+
+	err := os.WriteFile("data14.zip", zipBytes(map[string]string{"data.csv": compressTestCSV}), 0644)
+	require.NoError(err)
+
+	file, err := os.Open("data14.zip")
+	require.NoError(err)
+	defer file.Close()
+
+	data, err := suite.readAll("data14.zip", file)
+	require.NoError(err)
+	require.Equal(compressTestCSV, data)
+
+	err = deleteCSV("data14.zip")
+	require.NoError(err)
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_ZipMultipleFiles_Failure() {
+	require := suite.Require()
+	expectedError := "zip archive must contain exactly one file"
+
+	archive := zipBytes(map[string]string{"a.csv": compressTestCSV, "b.csv": compressTestCSV})
+	_, err := suite.readAll("data.zip", bytes.NewReader(archive))
+	require.EqualError(err, expectedError)
+}
+
+func (suite *CompressTestSuite) TestCompress_decompress_InvalidGzip_Failure() {
+	require := suite.Require()
+
+	_, err := suite.readAll("data.csv.gz", strings.NewReader(compressTestCSV))
+	require.ErrorIs(err, gzip.ErrHeader)
+}
+
+func (suite *CompressTestSuite) TestCompress_validExtension() {
+	require := suite.Require()
+
+	for path, valid := range map[string]bool{
+		"data.csv":     true,
+		"data.CSV":     true,
+		"data.csv.gz":  true,
+		"data.csv.zst": true,
+		"data.zip":     true,
+		"data.tsv":     true,
+		"data.txt.zst": true,
+		"data.gz":      false,
+		"data.json":    false,
+	} {
+		require.Equal(valid, validExtension(path), path)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	suite.Run(t, new(CompressTestSuite))
+}
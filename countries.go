@@ -0,0 +1,175 @@
+package geoolocation
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// iso3166 is the table of the officially assigned ISO 3166-1 alpha-2 codes and the
+// short names of their countries.
+//
+//go:embed data/iso3166-1.csv
+var iso3166 string
+
+// countryAliasTable is the table of the other names of the countries, and the names
+// of the user-assigned codes vendors use.
+//
+//go:embed data/country-aliases.csv
+var countryAliasTable string
+
+// countryNames maps the ISO 3166-1 alpha-2 codes to the names of the countries.
+var countryNames = make(map[string]string)
+
+// countryAliases maps the codes to the other names of the countries.
+var countryAliases = make(map[string][]string)
+
+func init() {
+	for _, record := range readTable(iso3166) {
+		countryNames[record[0]] = record[1]
+	}
+
+	for _, record := range readTable(countryAliasTable) {
+		countryAliases[record[0]] = append(countryAliases[record[0]], record[1])
+	}
+}
+
+// readTable returns the records of an embedded CSV table without the header.
+func readTable(table string) [][]string {
+	records, err := csv.NewReader(strings.NewReader(table)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded table: %v", err))
+	}
+
+	return records[1:]
+}
+
+// normalizeCountryCode trims the spaces around the code and upper-cases it.
+func normalizeCountryCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CountryCodeRule returns the country code rule, which normalizes the code to upper
+// case without spaces, and accepts the officially assigned ISO 3166-1 alpha-2 codes
+// and the allowed ones. The codes vendors use beside them, e.g. XK for Kosovo, EU
+// for the European Union or AP for Asia/Pacific, are user-assigned or reserved
+// codes, which must be allowed:
+//
+//	AddRules: []Rule{CountryCodeRule("XK", "EU", "AP")}
+func CountryCodeRule(allowed ...string) Rule {
+	codes := make(map[string]bool, len(allowed))
+	for _, code := range allowed {
+		codes[normalizeCountryCode(code)] = true
+	}
+
+	return NewRule(RuleCountryCode, func(row *Row) error {
+		code := normalizeCountryCode(row.CountryCode)
+		if _, ok := countryNames[code]; !ok && !codes[code] {
+			return fmt.Errorf("%q is not an ISO 3166-1 alpha-2 code", row.CountryCode)
+		}
+
+		row.CountryCode = code
+
+		return nil
+	})
+}
+
+// The name of the country name rule.
+const RuleCountryName = "country name"
+
+// CountryNameMode is what CountryNameRule does with a country that isn't named like
+// its country code.
+type CountryNameMode int
+
+const (
+	// CountryNameReject rejects the row.
+	CountryNameReject CountryNameMode = iota
+
+	// CountryNameFlag flags the row, see Flag.
+	CountryNameFlag
+
+	// CountryNameRewrite replaces the country of every row, mismatched or not, with
+	// the ISO 3166-1 name of the code.
+	CountryNameRewrite
+)
+
+// CountryNameRule returns the country name rule, which checks the country is named
+// like its code in the ISO 3166-1 table or by one of its aliases, e.g. Czech
+// Republic for CZ. The names are compared case-insensitively, ignoring punctuation.
+// The aliases are added to the embedded ones, by code. The rows with an empty country
+// or a code without a name are accepted as they are, except that an empty country is
+// filled in by CountryNameRewrite. The rule isn't one of the default rules:
+//
+//	AddRules: []Rule{CountryNameRule(CountryNameFlag, map[string][]string{"GB": {"England"}})}
+func CountryNameRule(mode CountryNameMode, aliases map[string][]string) Rule {
+	// The canonical name and the normalized names of every code.
+	canonical := make(map[string]string, len(countryNames))
+	names := make(map[string]map[string]bool, len(countryNames))
+	add := func(code string, name string) {
+		code = normalizeCountryCode(code)
+		if _, ok := canonical[code]; !ok {
+			canonical[code] = name
+			names[code] = make(map[string]bool)
+		}
+		names[code][normalizeCountryName(name)] = true
+	}
+
+	for code, name := range countryNames {
+		add(code, name)
+	}
+	for _, a := range []map[string][]string{countryAliases, aliases} {
+		for code, codeAliases := range a {
+			for _, alias := range codeAliases {
+				add(code, alias)
+			}
+		}
+	}
+
+	return NewRule(RuleCountryName, func(row *Row) error {
+		code := normalizeCountryCode(row.CountryCode)
+		name, ok := canonical[code]
+		if !ok {
+			return nil
+		}
+
+		if mode == CountryNameRewrite {
+			// The default country rule quotes the names with a quote.
+			if strings.Contains(name, "'") {
+				name = "'" + name + "'"
+			}
+			row.Country = name
+
+			return nil
+		}
+
+		if row.Country == "" || names[code][normalizeCountryName(row.Country)] {
+			return nil
+		}
+
+		err := fmt.Errorf("%q isn't the name of %s, %s", row.Country, code, name)
+		if mode == CountryNameFlag {
+			return Flag(err)
+		}
+
+		return err
+	})
+}
+
+// normalizeCountryName lower-cases the name and drops its punctuation and extra
+// spaces, so "Korea, Republic of" matches "korea republic of".
+func normalizeCountryName(name string) string {
+	return strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		case r == '\'' || r == '’':
+			return -1
+		case unicode.IsPunct(r) || unicode.IsSpace(r):
+			return ' '
+		}
+
+		return r
+	}, name)), " ")
+}
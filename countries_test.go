@@ -0,0 +1,124 @@
+package geoolocation
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type CountriesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CountriesTestSuite) TestCountries_countryNames() {
+	require := suite.Require()
+
+	require.Len(countryNames, 249)
+	require.Equal("Czechia", countryNames["CZ"])
+	require.Equal("Côte d'Ivoire", countryNames["CI"])
+	require.Equal("Korea, Republic of", countryNames["KR"])
+}
+
+func (suite *CountriesTestSuite) TestCountries_CountryCodeRule() {
+	require := suite.Require()
+
+	tests := []struct {
+		desc         string
+		rule         Rule
+		code         string
+		valid        bool
+		expectedCode string
+	}{
+		{"Assigned code", CountryCodeRule(), "US", true, "US"},
+		{"Lower case and spaces", CountryCodeRule(), " de\t", true, "DE"},
+		{"Code inside text", CountryCodeRule(), "xxUSyy", false, "xxUSyy"},
+		{"Unassigned code", CountryCodeRule(), "ZZ", false, "ZZ"},
+		{"Reserved code", CountryCodeRule(), "QQ", false, "QQ"},
+		{"Empty code", CountryCodeRule(), "", false, ""},
+		{"User-assigned code not allowed", CountryCodeRule("EU"), "XK", false, "XK"},
+		{"User-assigned code allowed", CountryCodeRule(" xk", "EU", "AP"), "xk ", true, "XK"},
+	}
+
+	for _, t := range tests {
+		suite.Run(t.desc, func() {
+			row := &Row{CountryCode: t.code}
+			err := t.rule.Validate(row)
+			require.Equal(t.valid, err == nil)
+			require.Equal(t.expectedCode, row.CountryCode)
+			require.Equal(RuleCountryCode, t.rule.Name())
+		})
+	}
+}
+
+func (suite *CountriesTestSuite) TestCountries_CountryNameRule() {
+	require := suite.Require()
+
+	aliases := map[string][]string{"gb": {"England"}}
+	tests := []struct {
+		desc            string
+		mode            CountryNameMode
+		code            string
+		country         string
+		valid           bool
+		flagged         bool
+		expectedCountry string
+	}{
+		{"ISO name", CountryNameReject, "CZ", "Czechia", true, false, "Czechia"},
+		{"Alias", CountryNameReject, "CZ", "czech  republic", true, false, "czech  republic"},
+		{"Punctuation", CountryNameReject, "KR", "Korea Republic Of", true, false, "Korea Republic Of"},
+		{"Quoted name", CountryNameReject, "CI", "'Cote d'Ivoire'", true, false, "'Cote d'Ivoire'"},
+		{"User alias", CountryNameReject, "GB", "England", true, false, "England"},
+		{"User-assigned code", CountryNameReject, "XK", "Kosovo", true, false, "Kosovo"},
+		{"Unknown code", CountryNameReject, "QQ", "Nepal", true, false, "Nepal"},
+		{"Empty country", CountryNameReject, "SI", "", true, false, ""},
+		{"Mismatch rejected", CountryNameReject, "SI", "Nepal", false, false, "Nepal"},
+		{"Mismatch flagged", CountryNameFlag, "SI", "Nepal", false, true, "Nepal"},
+		{"Mismatch rewritten", CountryNameRewrite, "si", "Nepal", true, false, "Slovenia"},
+		{"Alias rewritten", CountryNameRewrite, "CZ", "Czech Republic", true, false, "Czechia"},
+		{"Empty country rewritten", CountryNameRewrite, "CI", "", true, false, "'Côte d'Ivoire'"},
+	}
+
+	for _, t := range tests {
+		suite.Run(t.desc, func() {
+			row := &Row{CountryCode: t.code, Country: t.country}
+			err := CountryNameRule(t.mode, aliases).Validate(row)
+			require.Equal(t.valid, err == nil)
+
+			var flagErr *flagError
+			require.Equal(t.flagged, errors.As(err, &flagErr))
+			require.Equal(t.expectedCountry, row.Country)
+		})
+	}
+}
+
+func (suite *CountriesTestSuite) TestCountries_ImportReader_Flag_Success() {
+	require := suite.Require()
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"200.106.141.15,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346\n" +
+		"160.103.7.140,CZ,Czech Republic,New Neva,-68.31023296602508,-37.62435199624531,7301823115\n"
+
+	var flagged []FlaggedRow
+	result, err := new(Geo).ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		DryRun:   true,
+		AddRules: []Rule{CountryNameRule(CountryNameFlag, nil)},
+		OnFlag: func(row FlaggedRow) {
+			flagged = append(flagged, row)
+		},
+	})
+	require.NoError(err)
+	require.Equal(int64(2), result.AcceptedRows)
+	require.Equal(map[string]int64{"country name": 1}, result.Flagged)
+	require.Equal([]FlaggedRow{{
+		Line:   2,
+		Record: strings.Split("200.106.141.15,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346", ","),
+		Rule:   "country name",
+		Reason: `"Nepal" isn't the name of SI, Slovenia`,
+	}}, flagged)
+}
+
+func TestCountries(t *testing.T) {
+	suite.Run(t, new(CountriesTestSuite))
+}
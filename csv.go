@@ -1,6 +1,8 @@
 package geoolocation
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"errors"
@@ -8,22 +10,39 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/zeynab-sb/geoolocation/database"
 	"io"
-	"net"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 type csvImporter struct {
-	// Address of the file to be imported
+	// Address of the file to be imported, empty when importing from a reader
 	path string
 
+	// The CSV stream to be imported
+	source io.Reader
+
+	// The files imported together by Geo.ImportFiles, each of them becomes the path and
+	// the source in turn. file is the index of the one being read.
+	paths []string
+	file  int
+
+	// Counts the bytes read from the files for the progress.
+	counter *countingReader
+
+	// Counts the rows of each of the paths, nil unless several files are imported together.
+	files []importStats
+
 	// Address of the sanitized file
 	sanitizedPath string
 
+	// Number of goroutines reading a large uncompressed file in parallel, see readParallel.
+	readConcurrency int
+
 	// Number of concurrent processes
 	concurrency int
 	driver      database.Driver
@@ -34,195 +53,730 @@ type csvImporter struct {
 
 	// The sanitizer sends a signal on this channel when its work is done, and the load will start loading by receiving this signal.
 	signal chan bool
+
+	// Reports the rejected rows, nil if nobody asked for them.
+	rejecter *rejecter
+
+	// Counts the rows through the reader and the sanitizers.
+	stats importStats
+
+	// Reports the progress, nil if nobody asked for it.
+	progress *progressReporter
+
+	// Validates the rows without creating the sanitized file or loading anything.
+	dryRun bool
+
+	// Where the fields are found in the source, nil if the header must be csvHeader.
+	columns *ColumnMapping
+
+	// How the source is parsed, nil for the defaults.
+	dialect *Dialect
+
+	// The rules validating the rows, nil for the default rules.
+	rules []Rule
+
+	// Receives the flagged rows, never concurrently thanks to flagM.
+	onFlag func(FlaggedRow)
+	flagM  sync.Mutex
+
+	// How the sanitized rows are loaded, nil for appending.
+	loadOptions *database.LoadOptions
+
+	// Spools the sanitized rows to a temporary file in tempDir and loads it once they're
+	// all sanitized, instead of streaming them to the database.
+	spool   bool
+	tempDir string
+
+	// The sanitized file and its writer, which is shared by the sanitizers and guarded by m.
+	sanitizedFile *os.File
+	writer        *csv.Writer
+	m             sync.Mutex
+
+	// The sanitized rows are streamed to the load through this pipe, nil if they're spooled.
+	stream *io.PipeWriter
+
+	// The streaming load sends its result on this channel.
+	streamed chan streamResult
+
+	// Cancels the read and the sanitizers with the error of a failed streaming load,
+	// nil if nothing needs to be stopped.
+	cancel context.CancelCauseFunc
+
+	// The rows sent to the sanitizers and not done yet, only counted in a checkpointed import.
+	pending sync.WaitGroup
+
+	// The last checkpoint saved or resumed from, nil if the import isn't checkpointed.
+	checkpoint *database.Checkpoint
+
+	// The number of rows read between checkpoints, 0 if the import isn't checkpointed.
+	checkpointRows int64
+
+	// The position of the source following the last row read.
+	position database.Checkpoint
+
+	// The rows loaded by the saved checkpoints.
+	loaded database.LoadResult
+}
+
+// importStats counts the rows of an import. It is safe for concurrent use.
+type importStats struct {
+	// The number of rows read from the source.
+	read atomic.Int64
+
+	// The number of rows that can't be parsed as CSV.
+	parseErrors atomic.Int64
+
+	// The number of rows written to the sanitized file.
+	sanitized atomic.Int64
+
+	// The number of rows rejected by sanitizing.
+	rejectedRows atomic.Int64
+
+	m        sync.Mutex
+	rejected map[string]int64
+	flagged  map[string]int64
+}
+
+// reject counts a row rejected by sanitizing.
+func (s *importStats) reject(reason string) {
+	s.rejectedRows.Add(1)
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.rejected == nil {
+		s.rejected = make(map[string]int64)
+	}
+	s.rejected[reason]++
+}
+
+// flag counts a row flagged by the rule.
+func (s *importStats) flag(rule string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.flagged == nil {
+		s.flagged = make(map[string]int64)
+	}
+	s.flagged[rule]++
+}
+
+// flaggedByRule returns a copy of the flagged rows count by rule, nil if no row is
+// flagged.
+func (s *importStats) flaggedByRule() map[string]int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.flagged == nil {
+		return nil
+	}
+
+	flagged := make(map[string]int64, len(s.flagged))
+	for rule, n := range s.flagged {
+		flagged[rule] = n
+	}
+
+	return flagged
+}
+
+// rejectedByReason returns a copy of the rejected rows count by reason.
+func (s *importStats) rejectedByReason() map[string]int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	rejected := make(map[string]int64, len(s.rejected))
+	for reason, n := range s.rejected {
+		rejected[reason] = n
+	}
+
+	return rejected
 }
 
 // csvHeader contains valid headers
 var csvHeader []string
 
-// countryCodeRegex contains code pattern that is two capital letter .
+// deltaHeader contains valid headers of a delta import.
+var deltaHeader []string
+
 // sqlPatternRegex contains some sql commands.
-var countryCodeRegex, sqlPatternRegex *regexp.Regexp
+var sqlPatternRegex *regexp.Regexp
 
 func init() {
 	csvHeader = []string{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"}
-	countryCodeRegex = regexp.MustCompile(`[A-Z]{2}`)
+	deltaHeader = []string{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value", "operation"}
 	sqlPatternRegex = regexp.MustCompile(`(?i)\b(?:SELECT|INSERT|UPDATE|DELETE|UNION|OR|DROP|EXEC(UTE)?|ALTER|CREATE|TRUNCATE)\b`)
 }
 
-// setUpSanitizer creates the sanitized file and sets up go routines to listen on channel data,
-// sanitize each row, and then write it to the file async. At the end of this process it sends signal
-// for loading.
-func (i *csvImporter) setUpSanitizer() error {
-	i.sanitizedPath = fmt.Sprintf("../%s_sanitized.csv", strings.TrimSuffix(filepath.Base(i.path), ".csv"))
-	sanitizedFile, err := os.Create(i.sanitizedPath)
+// streamResult is the result of a streaming load.
+type streamResult struct {
+	loaded *database.LoadResult
+	err    error
+}
+
+// setUpSanitizer sets up go routines to listen on channel data, sanitize each row, and then
+// write it async. At the end of this process it sends signal for loading. The sanitized rows
+// are streamed to a load started here, or when spooling, written to a temporary file. In a
+// dry run the sanitized rows are discarded. Once ctx is done the remaining rows are drained
+// without being sanitized.
+func (i *csvImporter) setUpSanitizer(ctx context.Context) error {
+	if i.dryRun {
+		i.writer = csv.NewWriter(io.Discard)
+		go func() {
+			i.sanitize(ctx)
+			i.signal <- true
+		}()
+
+		return nil
+	}
+
+	if !i.spool {
+		i.setUpStream(ctx)
+		return nil
+	}
+
+	pattern := "geoolocation_*_sanitized.csv"
+	if i.path != "" {
+		pattern = baseName(i.path) + "_*_sanitized.csv"
+	}
+
+	sanitizedFile, err := os.CreateTemp(i.tempDir, pattern)
 	if err != nil {
 		return err
 	}
+	i.sanitizedPath = sanitizedFile.Name()
+	i.sanitizedFile = sanitizedFile
+	i.writer = csv.NewWriter(sanitizedFile)
+
+	go func() {
+		i.sanitize(ctx)
+		if err := sanitizedFile.Close(); err != nil {
+			logrus.Errorf("error closing sanitized file: %v", err)
+		}
+		i.signal <- true
+	}()
 
-	go func(file *os.File) {
-		defer file.Close()
+	return nil
+}
 
-		writer := csv.NewWriter(file)
-		defer writer.Flush()
+// setUpStream starts loading the rows the sanitizers write to a pipe. The load fails
+// if the pipe is closed with an error. If the load fails, the import is canceled with
+// its error, so the rest of the source isn't read for nothing.
+func (i *csvImporter) setUpStream(ctx context.Context) {
+	r, w := io.Pipe()
+	i.stream = w
+	i.writer = csv.NewWriter(w)
+	i.streamed = make(chan streamResult, 1)
+
+	go func() {
+		loaded, err := i.driver.LoadReader(ctx, r, i.loadOptions)
+		_ = r.Close()
+		if err != nil && i.cancel != nil {
+			i.cancel(err)
+		}
+		i.streamed <- streamResult{loaded: loaded, err: err}
+	}()
 
-		var wg sync.WaitGroup
-		wg.Add(i.concurrency)
+	go func() {
+		i.sanitize(ctx)
+		i.signal <- true
+	}()
+}
 
-		var m sync.Mutex
-		for j := 0; j < i.concurrency; j++ {
-			go func() {
-				defer wg.Done()
-				for d := range i.data {
-					err := d.sanitize()
-					if err != nil {
-						logrus.Warnf("data rejected: %v, value: %s", err, d)
-						continue
-					}
+// abort waits for the sanitizers after a failed read, and fails the streaming load so
+// nothing of the import is committed.
+func (i *csvImporter) abort(err error) {
+	<-i.signal
+
+	if i.stream != nil {
+		_ = i.stream.CloseWithError(err)
+		<-i.streamed
+	}
+}
 
-					m.Lock()
-					if err := writer.Write([]string{d.ipAddress, d.countryCode, d.country, d.city, d.latitude, d.longitude, d.mysteryValue}); err != nil {
-						logrus.Errorf("error writing a record: %s :%v", d, err)
-					}
-					m.Unlock()
+// sanitize runs the sanitizer go routines and writes the sanitized rows to the writer.
+// It returns once the data channel is closed and all the rows are done.
+func (i *csvImporter) sanitize(ctx context.Context) {
+	defer i.writer.Flush()
+
+	var wg sync.WaitGroup
+	wg.Add(i.concurrency)
+
+	for j := 0; j < i.concurrency; j++ {
+		go func() {
+			defer wg.Done()
+			for d := range i.data {
+				i.sanitizeRow(ctx, d)
+				if i.checkpointRows > 0 {
+					i.pending.Done()
 				}
-			}()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// sanitizeRow sanitizes the row and writes it to the writer, or reports it as rejected.
+func (i *csvImporter) sanitizeRow(ctx context.Context, d csvData) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	original := i.record(d)
+	flags, err := i.sanitizeData(&d)
+	if err != nil {
+		logrus.Warnf("data rejected: %v, value: %s", err, d)
+		i.stats.reject(err.Error())
+		if i.files != nil {
+			i.files[d.file].reject(err.Error())
 		}
 
-		wg.Wait()
-		i.signal <- true
-	}(sanitizedFile)
+		row := RejectedRow{Line: d.line, Record: original, Reason: err.Error(), File: i.rejectedFile(d.file)}
+		if err := i.rejecter.reject(row); err != nil {
+			logrus.Errorf("error reporting a rejected record: %s :%v", d, err)
+		}
+		return
+	}
 
-	return nil
+	for _, row := range flags {
+		i.flag(d, original, row)
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	if err := i.writer.Write(i.sanitizedRecord(d)); err != nil {
+		logrus.Errorf("error writing a record: %s :%v", d, err)
+	} else {
+		i.stats.sanitized.Add(1)
+	}
 }
 
 // read gets each row of CSV and sends it to the data channel. If any issue happens here, it closes
-// the data channel, and the go routines in sanitizer will close.
-func (i *csvImporter) read() (int64, error) {
+// the data channel, and the go routines in sanitizer will close. It stops with the
+// context error once ctx is done. Compressed sources are decompressed on the fly. In a
+// checkpointed import, the source is skipped to the checkpoint, and a checkpoint is saved
+// every checkpointRows rows. Large uncompressed files may be read in parallel.
+func (i *csvImporter) read(ctx context.Context) (int64, error) {
 	defer close(i.data)
 
-	file, err := os.Open(i.path)
+	if i.paths == nil {
+		return i.readSource(ctx)
+	}
+
+	var totalRows int64
+	for j, path := range i.paths {
+		n, err := i.readFile(ctx, j, path)
+		totalRows += n
+		if err != nil && len(i.paths) > 1 {
+			err = fmt.Errorf("%s: %w", path, err)
+		}
+		if err != nil {
+			return totalRows, err
+		}
+	}
+
+	return totalRows, nil
+}
+
+// readFile reads the file, the jth of the paths.
+func (i *csvImporter) readFile(ctx context.Context, j int, path string) (int64, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return 0, err
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	header, err := reader.Read()
+	i.file, i.path = j, path
+	i.counter.r = file
+	i.source = i.counter
+
+	return i.readSource(ctx)
+}
+
+// readSource reads the rows of the source, see read.
+func (i *csvImporter) readSource(ctx context.Context) (int64, error) {
+	if ra, size, ok := i.parallelSource(); ok {
+		return i.readParallel(ctx, ra, size)
+	}
+
+	source, err := decompress(i.path, i.source)
 	if err != nil {
-		return 0, errors.New("error reading csv header")
+		return 0, err
 	}
+	defer source.Close()
 
-	if len(header) != len(csvHeader) {
-		return 0, errors.New("invalid csv header")
+	// The CSV reader shares the buffer, so the source can be skipped after the header.
+	buffered := bufio.NewReader(source)
+	reader := newCSVReader(buffered, i.path, i.dialect)
+
+	var header []string
+	if i.columns == nil || !i.columns.NoHeader {
+		header, err = reader.Read()
+		if err != nil {
+			return 0, errors.New("error reading csv header")
+		}
+	}
+
+	columns, err := resolveColumns(header, i.fields(), i.columns)
+	if err != nil {
+		return 0, err
 	}
 
-	for j := range csvHeader {
-		if header[j] != csvHeader[j] {
-			return 0, errors.New("invalid csv header")
+	// The offset and the line of the source the reader starts counting from.
+	var offsetBase, lineBase int64
+	if i.checkpoint != nil {
+		i.position = *i.checkpoint
+		if i.checkpoint.Offset > 0 {
+			lineBase, err = skipSource(buffered, i.checkpoint.Offset-reader.InputOffset())
+			if err != nil {
+				return 0, err
+			}
+			offsetBase = i.checkpoint.Offset - reader.InputOffset()
 		}
 	}
 
 	var totalRows int64
 	for {
+		if err := ctx.Err(); err != nil {
+			return totalRows, err
+		}
+
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
 
 		totalRows++
+		line, err := i.sendRecord(ctx, reader, record, err, columns, lineBase)
 		if err != nil {
-			logrus.Errorf("error reading a record: %s :%v", record, err)
-			continue
+			return totalRows, err
 		}
 
-		d := csvData{
-			ipAddress:    record[0],
-			countryCode:  record[1],
-			country:      record[2],
-			city:         record[3],
-			latitude:     record[4],
-			longitude:    record[5],
-			mysteryValue: record[6],
+		if err := i.advance(ctx, offsetBase+reader.InputOffset(), line, totalRows); err != nil {
+			return totalRows, err
 		}
-
-		i.data <- d
 	}
 
 	return totalRows, nil
 }
 
-// load import the sanitized file to the database based on the driver.
-func (i *csvImporter) load() (int64, error) {
-	<-i.signal
+// sendRecord sends the record read by the reader, or the error reading it, to the
+// data channel, or reports it as rejected if it can't be parsed. It returns the line
+// of the source the record starts on, counted from lineBase.
+func (i *csvImporter) sendRecord(ctx context.Context, reader *csv.Reader, record []string, err error, columns []int, lineBase int64) (int64, error) {
+	row := i.stats.read.Add(1)
+	if i.files != nil {
+		i.files[i.file].read.Add(1)
+	}
+	if err != nil {
+		logrus.Errorf("error reading a record: %s :%v", record, err)
 
-	return i.driver.Load(i.sanitizedPath)
+		row := RejectedRow{Record: record, Reason: err.Error()}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			row.Line = int64(parseErr.StartLine)
+			row.Reason = parseErr.Err.Error()
+		}
+
+		row.Line += lineBase
+		i.rejectRecord(row)
+
+		return row.Line, nil
+	}
+
+	pos, _ := reader.FieldPos(0)
+	line := int64(pos) + lineBase
+	fields := make([]string, len(columns))
+	for j, column := range columns {
+		if column >= len(record) {
+			fields = nil
+			break
+		}
+		fields[j] = record[column]
+	}
+
+	if fields == nil {
+		logrus.Errorf("error reading a record: %s :missing fields", record)
+		i.rejectRecord(RejectedRow{Line: line, Record: record, Reason: "missing fields"})
+
+		return line, nil
+	}
+
+	d := csvData{
+		file:         i.file,
+		line:         line,
+		row:          row,
+		ipAddress:    fields[0],
+		countryCode:  fields[1],
+		country:      fields[2],
+		city:         fields[3],
+		latitude:     fields[4],
+		longitude:    fields[5],
+		mysteryValue: fields[6],
+	}
+	if i.delta() {
+		d.operation = fields[7]
+	}
+
+	if i.checkpointRows > 0 {
+		i.pending.Add(1)
+	}
+
+	select {
+	case i.data <- d:
+	case <-ctx.Done():
+		if i.checkpointRows > 0 {
+			i.pending.Done()
+		}
+		return line, ctx.Err()
+	}
+
+	return line, nil
 }
 
-// clean removes the sanitized file.
-func (i *csvImporter) clean() {
-	err := os.Remove(i.sanitizedPath)
-	if err != nil {
-		logrus.Errorf("error removing sanitized file: %v", err)
+// advance moves the position past the row read, and saves a checkpoint every
+// checkpointRows rows.
+func (i *csvImporter) advance(ctx context.Context, offset int64, line int64, totalRows int64) error {
+	if i.checkpoint == nil {
+		return nil
+	}
+
+	i.position.Offset = offset
+	i.position.Line = line
+	i.position.Rows++
+
+	if totalRows%i.checkpointRows != 0 {
+		return nil
+	}
+
+	if err := i.saveCheckpoint(ctx); err != nil {
+		return err
 	}
+
+	return i.nextChunk()
 }
 
-type csvData struct {
-	ipAddress    string
-	countryCode  string
-	country      string
-	city         string
-	latitude     string
-	longitude    string
-	mysteryValue string
+// delta tells whether the rows carry an operation.
+func (i *csvImporter) delta() bool {
+	return i.loadOptions != nil && i.loadOptions.Mode == database.ModeDelta
 }
 
-// sanitize validate all the fields of CSV data and normalizes the names.
-func (d *csvData) sanitize() error {
-	if net.ParseIP(d.ipAddress) == nil {
-		return errors.New("invalid ip")
+// fields returns the fields of a row in the source.
+func (i *csvImporter) fields() []string {
+	if i.delta() {
+		return deltaHeader
 	}
 
-	if !countryCodeRegex.MatchString(d.countryCode) {
-		return errors.New("invalid country code")
+	return csvHeader
+}
+
+// ordered tells whether the rows carry their number, see sanitizedRecord.
+func (i *csvImporter) ordered() bool {
+	return i.loadOptions != nil && (i.loadOptions.Mode == database.ModeUpsert || i.loadOptions.Mode == database.ModeDelta)
+}
+
+// record returns the fields of the row in the order of fields.
+func (i *csvImporter) record(d csvData) []string {
+	if i.delta() {
+		return append(d.fields(), d.operation)
 	}
 
-	if sqlPatternRegex.MatchString(d.country) {
-		return errors.New("invalid country")
+	return d.fields()
+}
+
+// sanitizedRecord returns the fields of the row as they are written to the sanitized
+// file. In an upsert or a delta, the number of the row follows, so the driver keeps
+// the last row of an ip whatever order the sanitizers write them in.
+func (i *csvImporter) sanitizedRecord(d csvData) []string {
+	record := i.record(d)
+	if i.ordered() {
+		record = append(record, strconv.FormatInt(d.row, 10))
 	}
 
-	if strings.Contains(d.country, "'") {
-		d.country = fmt.Sprintf("'%s'", d.country)
+	return record
+}
+
+// sanitizeData sanitizes the row by the rules of the import based on its kind. It
+// returns the rules flagging the row.
+func (i *csvImporter) sanitizeData(d *csvData) ([]FlaggedRow, error) {
+	rules := i.rules
+	if rules == nil {
+		rules = defaultRules
 	}
 
-	if sqlPatternRegex.MatchString(d.city) {
-		return errors.New("invalid city")
+	if i.delta() {
+		return d.sanitizeDelta(rules)
 	}
 
-	if strings.Contains(d.city, "'") {
-		d.city = fmt.Sprintf("'%s'", d.city)
+	return d.validate(rules)
+}
+
+// flag counts and reports a row flagged by a rule.
+func (i *csvImporter) flag(d csvData, original []string, row FlaggedRow) {
+	logrus.Warnf("data flagged: %s, value: %s", row.Reason, d)
+	i.stats.flag(row.Rule)
+	if i.files != nil {
+		i.files[d.file].flag(row.Rule)
 	}
 
-	fLat, err := strconv.ParseFloat(d.latitude, 64)
-	if err != nil {
-		return errors.New("invalid latitude")
+	if i.onFlag == nil {
+		return
 	}
 
-	if !(-90 <= fLat && fLat <= 90) {
-		return errors.New("invalid latitude")
+	row.Line, row.Record, row.File = d.line, original, i.rejectedFile(d.file)
+
+	i.flagM.Lock()
+	defer i.flagM.Unlock()
+
+	i.onFlag(row)
+}
+
+// rejectRecord counts and reports a row that can't be parsed.
+func (i *csvImporter) rejectRecord(row RejectedRow) {
+	i.stats.parseErrors.Add(1)
+	if i.files != nil {
+		i.files[i.file].parseErrors.Add(1)
 	}
 
-	fLng, err := strconv.ParseFloat(d.longitude, 64)
-	if err != nil {
-		return errors.New("invalid longitude")
+	row.File = i.rejectedFile(i.file)
+	if err := i.rejecter.reject(row); err != nil {
+		logrus.Errorf("error reporting a rejected record: %s :%v", row.Record, err)
+	}
+}
+
+// rejectedFile returns the file of the rows rejected from the jth of the paths, empty
+// unless files are imported by Geo.ImportFiles.
+func (i *csvImporter) rejectedFile(j int) string {
+	if i.paths == nil {
+		return ""
 	}
 
-	if !(-180 <= fLng && fLng <= 180) {
-		return errors.New("invalid longitude")
+	return i.paths[j]
+}
+
+// load import the sanitized rows to the database based on the driver and the load options.
+// When streaming, it waits for the load started by setUpSanitizer. In a dry run nothing is
+// loaded, and all the sanitized rows count as inserted.
+func (i *csvImporter) load(ctx context.Context) (*database.LoadResult, error) {
+	i.progress.setPhase(PhaseSanitize)
+	<-i.signal
+
+	if i.dryRun {
+		return &database.LoadResult{Inserted: i.stats.sanitized.Load()}, nil
 	}
 
-	if _, err := strconv.ParseInt(d.mysteryValue, 10, 64); err != nil {
-		return errors.New("invalid mystery value")
+	i.progress.setPhase(PhaseLoad)
+
+	if i.stream != nil {
+		_ = i.stream.Close()
+		streamed := <-i.streamed
+
+		return streamed.loaded, streamed.err
 	}
 
-	return nil
+	if i.checkpoint == nil {
+		return i.driver.Load(ctx, i.sanitizedPath, i.loadOptions)
+	}
+
+	// The rest of the rows are loaded with the last checkpoint, so a failure
+	// while clearing it doesn't load them again.
+	if err := i.saveCheckpoint(ctx); err != nil {
+		return nil, err
+	}
+	i.clearCheckpoint(ctx)
+
+	loaded := i.loaded
+
+	return &loaded, nil
+}
+
+// baseName returns the file name of path without the data and compression extensions.
+func baseName(path string) string {
+	name := filepath.Base(path)
+	if compressionByExt(name) != compressionNone {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// clean removes the sanitized file.
+func (i *csvImporter) clean() {
+	if i.sanitizedPath == "" {
+		return
+	}
+
+	err := os.Remove(i.sanitizedPath)
+	if err != nil {
+		logrus.Errorf("error removing sanitized file: %v", err)
+	}
+}
+
+type csvData struct {
+	// The index of the file of the row in the paths.
+	file int
+
+	// The line of the source the row starts on.
+	line int64
+
+	// The number of the row in the order the rows are read, across the paths. It
+	// follows the source unless the file is read in parallel.
+	row int64
+
+	ipAddress    string
+	countryCode  string
+	country      string
+	city         string
+	latitude     string
+	longitude    string
+	mysteryValue string
+
+	// The operation of the row in a delta import.
+	operation string
+}
+
+// fields returns the fields in the order of csvHeader.
+func (d csvData) fields() []string {
+	return []string{d.ipAddress, d.countryCode, d.country, d.city, d.latitude, d.longitude, d.mysteryValue}
+}
+
+// String formats the fields of the row for logging.
+func (d csvData) String() string {
+	return "{" + strings.Join(d.fields(), " ") + "}"
+}
+
+// sanitize validates the row by the default rules and normalizes the names.
+func (d *csvData) sanitize() error {
+	_, err := d.validate(defaultRules)
+	return err
+}
+
+// sanitizeDelta validates the operation of a delta row and the fields it needs by the
+// rules. A delete only needs the ip, so it's only validated by the ip rule, if any,
+// and its other fields are written as NULL.
+func (d *csvData) sanitizeDelta(rules []Rule) ([]FlaggedRow, error) {
+	d.operation = strings.ToLower(strings.TrimSpace(d.operation))
+
+	switch d.operation {
+	case database.OperationAdd, database.OperationUpdate:
+		return d.validate(rules)
+	case database.OperationDelete:
+		var ipRules []Rule
+		if j := ruleIndex(rules, RuleIP); j >= 0 {
+			ipRules = rules[j : j+1]
+		}
+
+		flags, err := d.validate(ipRules)
+		if err != nil {
+			return nil, err
+		}
+
+		d.countryCode, d.country, d.city = database.NullField, database.NullField, database.NullField
+		d.latitude, d.longitude, d.mysteryValue = database.NullField, database.NullField, database.NullField
+
+		return flags, nil
+	}
+
+	return nil, errors.New("invalid operation")
 }
@@ -2,17 +2,23 @@ package geoolocation
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/agiledragon/gomonkey/v2"
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/suite"
 	"github.com/zeynab-sb/geoolocation/database"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -24,6 +30,7 @@ type CSVTestSuite struct {
 	db        *sql.DB
 	patch     *gomonkey.Patches
 	logBuffer bytes.Buffer
+	files     []*os.File
 }
 
 func (suite *CSVTestSuite) SetupSuite() {
@@ -60,13 +67,26 @@ func (suite *CSVTestSuite) TearDownSuit() {
 
 func (suite *CSVTestSuite) TearDownTest() {
 	suite.patch.Reset()
+
+	for _, f := range suite.files {
+		_ = f.Close()
+	}
+	suite.files = nil
 }
 
+// newImporter returns an importer reading from the file at path, when it exists.
 func (suite *CSVTestSuite) newImporter(path string, concurrency int) *csvImporter {
+	var source io.Reader
+	if file, err := os.Open(path); err == nil {
+		suite.files = append(suite.files, file)
+		source = file
+	}
+
 	data := make(chan csvData, 1)
 	signal := make(chan bool)
 	return &csvImporter{
 		path:        path,
+		source:      source,
 		concurrency: concurrency,
 		driver:      &database.MySQLDriver{DB: suite.db},
 		db:          suite.db,
@@ -82,19 +102,38 @@ func (suite *CSVTestSuite) TestCSV_setUpSanitizer_CreateSanitizedFile_Failure()
 	suite.patch.ApplyFuncReturn(os.OpenFile, nil, errors.New("error creating file"))
 
 	i := suite.newImporter("data.csv", 1)
-	err := i.setUpSanitizer()
+	i.spool = true
+	err := i.setUpSanitizer(context.Background())
 	require.EqualError(err, expectedError)
 }
 
+func (suite *CSVTestSuite) TestCSV_setUpSanitizer_Reader_Success() {
+	require := suite.Require()
+
+	importer := suite.newImporter("", 1)
+	importer.spool = true
+	err := importer.setUpSanitizer(context.Background())
+	require.NoError(err)
+
+	close(importer.data)
+	<-importer.signal
+
+	require.Equal(os.TempDir(), filepath.Dir(importer.sanitizedPath))
+	require.True(strings.HasSuffix(importer.sanitizedPath, "_sanitized.csv"))
+
+	err = os.Remove(importer.sanitizedPath)
+	require.NoError(err)
+}
+
 func (suite *CSVTestSuite) TestCSV_setUpSanitizer_Success() {
 	require := suite.Require()
-	expectedRow := []string{"127.0.0.1", "AC", "Test", "Test", "-35.437661078966926", "-134.6494137784682", "2147483647"}
-	expectedLogMsg := "time=\"2020-01-01T00:00:00Z\" level=warning msg=\"data rejected: invalid ip, value: {127.0.0 AC Test Test -35.437661078966926 -134.6494137784682 2147483647}\"\n"
+	expectedRow := []string{"127.0.0.1", "AD", "Test", "Test", "-35.437661078966926", "-134.6494137784682", "2147483647"}
+	expectedLogMsg := "time=\"2020-01-01T00:00:00Z\" level=warning msg=\"data rejected: invalid ip, value: {127.0.0 AD Test Test -35.437661078966926 -134.6494137784682 2147483647}\"\n"
 
 	data := map[string]csvData{
 		"correct_data": {
 			ipAddress:    "127.0.0.1",
-			countryCode:  "AC",
+			countryCode:  "AD",
 			country:      "Test",
 			city:         "Test",
 			latitude:     "-35.437661078966926",
@@ -103,7 +142,7 @@ func (suite *CSVTestSuite) TestCSV_setUpSanitizer_Success() {
 		},
 		"invalid_data": {
 			ipAddress:    "127.0.0",
-			countryCode:  "AC",
+			countryCode:  "AD",
 			country:      "Test",
 			city:         "Test",
 			latitude:     "-35.437661078966926",
@@ -116,7 +155,9 @@ func (suite *CSVTestSuite) TestCSV_setUpSanitizer_Success() {
 	logrus.SetOutput(&suite.logBuffer)
 
 	importer := suite.newImporter("data.csv", 1)
-	err := importer.setUpSanitizer()
+	importer.spool = true
+	importer.tempDir = suite.T().TempDir()
+	err := importer.setUpSanitizer(context.Background())
 
 	for _, d := range data {
 		importer.data <- d
@@ -127,16 +168,17 @@ func (suite *CSVTestSuite) TestCSV_setUpSanitizer_Success() {
 	<-importer.signal
 	require.NoError(err)
 
-	file, err := os.Open("../data_sanitized.csv")
+	require.Equal(importer.tempDir, filepath.Dir(importer.sanitizedPath))
+	require.True(strings.HasPrefix(filepath.Base(importer.sanitizedPath), "data_"))
+
+	file, err := os.Open(importer.sanitizedPath)
 	require.NoError(err)
+	suite.files = append(suite.files, file)
 
 	reader := csv.NewReader(file)
 	records, err := reader.ReadAll()
 	require.NoError(err)
 
-	err = os.Remove("../data_sanitized.csv")
-	require.NoError(err)
-
 	require.Equal(1, len(records))
 	require.Equal(expectedRow, records[0])
 	require.Contains(suite.logBuffer.String(), expectedLogMsg)
@@ -171,15 +213,150 @@ func deleteCSV(path string) error {
 	return nil
 }
 
-func (suite *CSVTestSuite) TestCSV_read_OpenFile_Failure() {
+// streamDriver loads the rows by reading the stream to the end.
+type streamDriver struct {
+	database.Driver
+	records [][]string
+	err     error
+}
+
+func (d *streamDriver) LoadReader(_ context.Context, r io.Reader, _ *database.LoadOptions) (*database.LoadResult, error) {
+	d.records, d.err = csv.NewReader(r).ReadAll()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &database.LoadResult{Inserted: int64(len(d.records))}, nil
+}
+
+// failingDriver fails the streaming load once the first rows are written.
+type failingDriver struct {
+	database.Driver
+}
+
+func (d *failingDriver) LoadReader(_ context.Context, r io.Reader, _ *database.LoadOptions) (*database.LoadResult, error) {
+	_, _ = r.Read(make([]byte, 1))
+
+	return nil, errors.New("load failed")
+}
+
+func (suite *CSVTestSuite) TestCSV_setUpSanitizer_Stream_Success() {
 	require := suite.Require()
-	expectedError := "error opening file"
+	expectedRecords := [][]string{{"127.0.0.1", "AD", "Test", "Test", "-35.437661078966926", "-134.6494137784682", "2147483647"}}
 
-	suite.patch.ApplyFuncReturn(os.OpenFile, nil, errors.New("error opening file"))
+	driver := &streamDriver{}
+	importer := suite.newImporter("data.csv", 2)
+	importer.driver = driver
+	err := importer.setUpSanitizer(context.Background())
+	require.NoError(err)
 
-	i := suite.newImporter("data.csv", 1)
-	_, err := i.read()
+	importer.data <- csvData{ipAddress: "127.0.0.1", countryCode: "AD", country: "Test", city: "Test",
+		latitude: "-35.437661078966926", longitude: "-134.6494137784682", mysteryValue: "2147483647"}
+	importer.data <- csvData{ipAddress: "127.0.0", countryCode: "AD", country: "Test", city: "Test",
+		latitude: "-35.437661078966926", longitude: "-134.6494137784682", mysteryValue: "2147483647"}
+	close(importer.data)
+
+	loaded, err := importer.load(context.Background())
+	require.NoError(err)
+	require.Equal(int64(1), loaded.Inserted)
+	require.Equal(expectedRecords, driver.records)
+	require.Empty(importer.sanitizedPath)
+}
+
+func (suite *CSVTestSuite) TestCSV_ImportReader_Upsert_Order() {
+	require := suite.Require()
+
+	// The sanitizers write the rows in any order, their numbers follow the source.
+	var source strings.Builder
+	source.WriteString("ip_address,country_code,country,city,latitude,longitude,mystery_value\n")
+	for j := 0; j < 200; j++ {
+		source.WriteString(fmt.Sprintf("1.1.1.%d,AD,Test,Test,-35.437661078966926,-134.6494137784682,%d\n", j%10, j+1))
+	}
+
+	driver := &streamDriver{}
+	result, err := (&Geo{driver: driver}).ImportReader(context.Background(), strings.NewReader(source.String()), &ImportOptions{
+		Concurrency: 4,
+		Mode:        database.ModeUpsert,
+		Stream:      true,
+	})
+	require.NoError(err)
+	require.Equal(int64(200), result.AcceptedRows)
+	require.Len(driver.records, 200)
+
+	for _, record := range driver.records {
+		require.Len(record, 8)
+		require.Equal(record[6], record[7])
+	}
+}
+
+func (suite *CSVTestSuite) TestCSV_ImportReader_Delta_Order() {
+	require := suite.Require()
+
+	// The delete of an ip is followed by its update, which must win.
+	var source strings.Builder
+	source.WriteString("ip_address,country_code,country,city,latitude,longitude,mystery_value,operation\n")
+	for j := 0; j < 100; j++ {
+		source.WriteString(fmt.Sprintf("1.1.1.%d,,,,,,,delete\n", j))
+		source.WriteString(fmt.Sprintf("1.1.1.%d,AD,Test,Test,-35.437661078966926,-134.6494137784682,%d,update\n", j, j))
+	}
+
+	driver := &streamDriver{}
+	_, err := (&Geo{driver: driver}).ImportReader(context.Background(), strings.NewReader(source.String()), &ImportOptions{
+		Concurrency: 4,
+		Mode:        database.ModeDelta,
+		Stream:      true,
+	})
+	require.NoError(err)
+	require.Len(driver.records, 200)
+
+	last := make(map[string]int64)
+	operations := make(map[string]string)
+	for _, record := range driver.records {
+		require.Len(record, 9)
+		row, err := strconv.ParseInt(record[8], 10, 64)
+		require.NoError(err)
+		if row > last[record[0]] {
+			last[record[0]], operations[record[0]] = row, record[7]
+		}
+	}
+	for _, operation := range operations {
+		require.Equal("update", operation)
+	}
+}
+
+func (suite *CSVTestSuite) TestCSV_ImportReader_Stream_LoadFailure() {
+	require := suite.Require()
+	expectedError := "load failed"
+
+	var data strings.Builder
+	data.WriteString("ip_address,country_code,country,city,latitude,longitude,mystery_value\n")
+	for j := 0; j < 20000; j++ {
+		data.WriteString("127.0.0.1,AD,Test,Test,-35.437661078966926,-134.6494137784682,2147483647\n")
+	}
+
+	// The read stops once the load fails, long before the end of the source.
+	source := strings.NewReader(data.String())
+	_, err := (&Geo{driver: &failingDriver{}}).ImportReader(context.Background(), source, &ImportOptions{
+		Concurrency: 2,
+		Stream:      true,
+	})
 	require.EqualError(err, expectedError)
+	require.Greater(source.Len(), data.Len()/2)
+}
+
+func (suite *CSVTestSuite) TestCSV_abort_Stream() {
+	require := suite.Require()
+	expectedError := "invalid csv header"
+
+	driver := &streamDriver{}
+	importer := suite.newImporter("data.csv", 1)
+	importer.driver = driver
+	err := importer.setUpSanitizer(context.Background())
+	require.NoError(err)
+
+	close(importer.data)
+	importer.abort(errors.New("invalid csv header"))
+	require.EqualError(driver.err, expectedError)
 }
 
 func (suite *CSVTestSuite) TestCSV_read_ReadingHeader_Failure() {
@@ -196,7 +373,7 @@ func (suite *CSVTestSuite) TestCSV_read_ReadingHeader_Failure() {
 	suite.patch.ApplyMethodReturn(&r, "Read", nil, errors.New("error"))
 
 	i := suite.newImporter("data1.csv", 1)
-	_, err = i.read()
+	_, err = i.read(context.Background())
 	require.EqualError(err, expectedError)
 
 	err = deleteCSV("data1.csv")
@@ -214,7 +391,7 @@ func (suite *CSVTestSuite) TestCSV_read_InvalidHeaderLength_Failure() {
 	require.NoError(err)
 
 	i := suite.newImporter("data2.csv", 1)
-	_, err = i.read()
+	_, err = i.read(context.Background())
 	require.EqualError(err, expectedError)
 
 	err = deleteCSV("data2.csv")
@@ -232,7 +409,7 @@ func (suite *CSVTestSuite) TestCSV_read_InvalidHeader_Failure() {
 	require.NoError(err)
 
 	i := suite.newImporter("data3.csv", 1)
-	_, err = i.read()
+	_, err = i.read(context.Background())
 	require.EqualError(err, expectedError)
 
 	err = deleteCSV("data3.csv")
@@ -244,8 +421,10 @@ func (suite *CSVTestSuite) TestCSV_read_Success() {
 	expectedRows := int64(3)
 	expectedData := []csvData{
 		{
+			line:         2,
+			row:          1,
 			ipAddress:    "127.0.0.1",
-			countryCode:  "TA",
+			countryCode:  "US",
 			country:      "test",
 			city:         "test",
 			latitude:     "48.92021642445653",
@@ -253,8 +432,10 @@ func (suite *CSVTestSuite) TestCSV_read_Success() {
 			mysteryValue: "2147483647",
 		},
 		{
+			line:         3,
+			row:          2,
 			ipAddress:    "127.0.0.2",
-			countryCode:  "TB",
+			countryCode:  "GB",
 			country:      "test",
 			city:         "test",
 			latitude:     "48.92021642545653",
@@ -266,8 +447,8 @@ func (suite *CSVTestSuite) TestCSV_read_Success() {
 
 	err := createCSV([][]string{
 		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
-		{"127.0.0.1", "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
-		{"127.0.0.2", "TB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
 		{"test", "test", "test", "test", "test", "test"},
 	}, "data4.csv")
 	require.NoError(err)
@@ -287,7 +468,7 @@ func (suite *CSVTestSuite) TestCSV_read_Success() {
 	suite.logBuffer.Truncate(0)
 	logrus.SetOutput(&suite.logBuffer)
 
-	total, err := i.read()
+	total, err := i.read(context.Background())
 	require.NoError(err)
 
 	wg.Wait()
@@ -299,27 +480,62 @@ func (suite *CSVTestSuite) TestCSV_read_Success() {
 	require.NoError(err)
 }
 
+func (suite *CSVTestSuite) TestCSV_read_Canceled_Failure() {
+	require := suite.Require()
+
+	err := createCSV([][]string{
+		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+	}, "data13.csv")
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nobody receives from the data channel, so the reader blocks on the
+	// second row until the context is canceled.
+	i := suite.newImporter("data13.csv", 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	total, err := i.read(ctx)
+	require.ErrorIs(err, context.Canceled)
+	require.Equal(int64(2), total)
+
+	_, ok := <-i.data
+	require.True(ok)
+	_, ok = <-i.data
+	require.False(ok)
+
+	err = deleteCSV("data13.csv")
+	require.NoError(err)
+}
+
 func (suite *CSVTestSuite) TestCSV_load_MySQL_DatabaseErr_Failure() {
 	require := suite.Require()
 	expectedError := "database error"
 
 	err := createCSV([][]string{
-		{"127.0.0.1", "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
-		{"127.0.0.2", "TB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
 	}, "../data5.csv")
 	require.NoError(err)
 
 	i := suite.newImporter("../data5.csv", 1)
 	i.sanitizedPath = "../data5.csv"
 
+	suite.sqlMock.ExpectBegin()
 	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '../data5.csv' IGNORE INTO TABLE locations (.+)").
 		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
 
 	go func() {
 		i.signal <- true
 	}()
 
-	_, err = i.load()
+	_, err = i.load(context.Background())
 	require.EqualError(err, expectedError)
 
 	err = deleteCSV("../data5.csv")
@@ -331,24 +547,26 @@ func (suite *CSVTestSuite) TestCSV_load_MySQL_Success() {
 	expectedRows := int64(2)
 
 	err := createCSV([][]string{
-		{"127.0.0.1", "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
-		{"127.0.0.2", "TB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
 	}, "../data6.csv")
 	require.NoError(err)
 
 	i := suite.newImporter("data6.csv", 1)
 	i.sanitizedPath = "../data6.csv"
 
+	suite.sqlMock.ExpectBegin()
 	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '../data6.csv' IGNORE INTO TABLE locations (.+)").
 		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectCommit()
 
 	go func() {
 		i.signal <- true
 	}()
 
-	inserted, err := i.load()
+	loaded, err := i.load(context.Background())
 	require.NoError(err)
-	require.Equal(expectedRows, inserted)
+	require.Equal(expectedRows, loaded.Inserted)
 
 	err = deleteCSV("../data6.csv")
 	require.NoError(err)
@@ -373,8 +591,8 @@ func (suite *CSVTestSuite) TestCSV_clean_Success() {
 	require := suite.Require()
 
 	err := createCSV([][]string{
-		{"127.0.0.1", "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
-		{"127.0.0.2", "TB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
 	}, "data8.csv")
 	require.NoError(err)
 
@@ -403,7 +621,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Valid CSV Data",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -413,7 +631,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			nil,
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -425,7 +643,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid ip",
 			csvData{
 				ipAddress:    "127.0.",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -435,7 +653,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid ip"),
 			csvData{
 				ipAddress:    "127.0.",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -469,7 +687,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid country",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "select",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -479,7 +697,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid country"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "select",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -491,7 +709,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Country contains '",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "te'st",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -501,7 +719,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			nil,
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "'te'st'",
 				city:         "test",
 				latitude:     "48.92021642445653",
@@ -513,7 +731,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid city",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "select",
 				latitude:     "48.92021642445653",
@@ -523,7 +741,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid city"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "select",
 				latitude:     "48.92021642445653",
@@ -535,7 +753,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"City contains '",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "te'st",
 				latitude:     "48.92021642445653",
@@ -545,7 +763,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			nil,
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "'te'st'",
 				latitude:     "48.92021642445653",
@@ -557,7 +775,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid lat not float",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "4gh",
@@ -567,7 +785,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid latitude"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "4gh",
@@ -579,7 +797,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid lat",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "148.92021642445653",
@@ -589,7 +807,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid latitude"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "148.92021642445653",
@@ -601,7 +819,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid lng not float",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "14.900399560492929",
@@ -611,7 +829,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid longitude"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "14.900399560492929",
@@ -623,7 +841,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid lng",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "14.92021642445653",
@@ -633,7 +851,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid longitude"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "14.92021642445653",
@@ -645,7 +863,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			"Invalid mystery value",
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "14.92021642445653",
@@ -655,7 +873,7 @@ func (suite *CSVTestSuite) TestCSV_sanitize() {
 			errors.New("invalid mystery value"),
 			csvData{
 				ipAddress:    "127.0.0.1",
-				countryCode:  "AB",
+				countryCode:  "AT",
 				country:      "test",
 				city:         "test",
 				latitude:     "14.92021642445653",
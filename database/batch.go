@@ -0,0 +1,408 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultBatchSize is the number of rows inserted by one statement by default.
+const defaultBatchSize = 1000
+
+// maxBatchParams is the most parameters a statement can have on MySQL and Postgres.
+const maxBatchParams = 65535
+
+// BatchDriver loads the rows by parameterized multi-row INSERTs, for the servers that
+// reject the bulk load of MySQLDriver and PostgresDriver, e.g. managed instances
+// running with local_infile=0. It's slower, but the duplicates are skipped and the
+// modes are applied the same way.
+type BatchDriver struct {
+	DB *sql.DB
+
+	// Dialect is the driver of DB, either mysql or postgres.
+	Dialect string
+
+	// The number of rows inserted by one statement, 1000 by default. It's lowered
+	// to fit the 65535 parameters a statement can have.
+	BatchSize int
+
+	// The number of statements run at the same time, 1 by default. With 1, the
+	// batches of a load are inserted in one transaction, otherwise every batch is
+	// committed on its own, so a failed load may leave the batches before the
+	// failure inserted. Checkpointed loads, and upserts and deltas on Postgres, which
+	// fill a temporary table, always insert one batch at a time.
+	Concurrency int
+}
+
+// bulkDriver is a driver applying the modes to the rows filled in by any loader.
+type bulkDriver interface {
+	Driver
+	load(ctx context.Context, l loader, opts *LoadOptions) (*LoadResult, error)
+}
+
+// bulk returns the bulk driver of the dialect.
+func (d *BatchDriver) bulk() (bulkDriver, error) {
+	switch d.Dialect {
+	case "mysql":
+		return &MySQLDriver{DB: d.DB}, nil
+	case "postgres":
+		return &PostgresDriver{DB: d.DB}, nil
+	}
+
+	return nil, errors.New("invalid database driver")
+}
+
+// Load opens the file and inserts its rows, see LoadReader.
+func (d *BatchDriver) Load(ctx context.Context, path string, opts *LoadOptions) (*LoadResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return d.LoadReader(ctx, file, opts)
+}
+
+// LoadReader inserts the CSV rows of r by batches. `\N` is inserted as NULL.
+func (d *BatchDriver) LoadReader(ctx context.Context, r io.Reader, opts *LoadOptions) (*LoadResult, error) {
+	bulk, err := d.bulk()
+	if err != nil {
+		return nil, err
+	}
+
+	// The bulk drivers append in one transaction, which would insert one batch at a
+	// time.
+	if opts == nil || opts.Mode == ModeAppend && opts.Checkpoint == nil {
+		insertedRows, err := d.insert(ctx, nil, r, locationsTable, locationColumns, true)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoadResult{Inserted: insertedRows}, nil
+	}
+
+	return bulk.load(ctx, func(ctx context.Context, tx *sql.Tx, table string, columns string, ignore bool) (int64, error) {
+		return d.insert(ctx, tx, r, table, columns, ignore)
+	}, opts)
+}
+
+// insert inserts the rows of r into the columns of the table, in tx one batch at a
+// time, or if tx is nil, by Concurrency statements at the same time.
+func (d *BatchDriver) insert(ctx context.Context, tx *sql.Tx, r io.Reader, table string, columns string, ignore bool) (int64, error) {
+	fields := len(strings.Split(columns, ","))
+	size := d.batchSize(fields)
+
+	var rows, insertedRows int64
+	var err error
+	switch {
+	case tx != nil:
+		rows, insertedRows, err = d.insertBatches(ctx, tx, r, table, columns, fields, size, ignore)
+	case d.Concurrency <= 1:
+		insertedRows, err = inTx(ctx, d.DB, func(tx *sql.Tx) (int64, error) {
+			var insertedRows int64
+			var err error
+			rows, insertedRows, err = d.insertBatches(ctx, tx, r, table, columns, fields, size, ignore)
+
+			return insertedRows, err
+		})
+	default:
+		rows, insertedRows, err = d.insertConcurrently(ctx, r, table, columns, fields, size, ignore)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if duplicates := rows - insertedRows; ignore && duplicates > 0 {
+		logrus.Infof("%d duplicate rows skipped", duplicates)
+	}
+
+	return insertedRows, nil
+}
+
+// insertBatches inserts the batches one after another in tx. It returns the number
+// of rows read and inserted.
+func (d *BatchDriver) insertBatches(ctx context.Context, tx *sql.Tx, r io.Reader, table string, columns string, fields int, size int, ignore bool) (int64, int64, error) {
+	var insertedRows int64
+	rows, err := readBatches(r, fields, size, func(args []interface{}) error {
+		result, err := tx.ExecContext(ctx, d.insertQuery(table, columns, fields, len(args)/fields, ignore), args...)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		insertedRows += affected
+
+		return err
+	})
+
+	return rows, insertedRows, err
+}
+
+// insertConcurrently inserts the batches by Concurrency workers, every batch in its
+// own transaction. It returns the number of rows read and inserted.
+func (d *BatchDriver) insertConcurrently(ctx context.Context, r io.Reader, table string, columns string, fields int, size int, ignore bool) (int64, int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan []interface{})
+	errs := make(chan error, d.Concurrency)
+	var insertedRows atomic.Int64
+	var wg sync.WaitGroup
+
+	for j := 0; j < d.Concurrency; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for args := range batches {
+				result, err := d.DB.ExecContext(ctx, d.insertQuery(table, columns, fields, len(args)/fields, ignore), args...)
+				if err == nil {
+					var affected int64
+					affected, err = result.RowsAffected()
+					insertedRows.Add(affected)
+				}
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	rows, err := readBatches(r, fields, size, func(args []interface{}) error {
+		select {
+		case batches <- args:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(batches)
+	wg.Wait()
+
+	// The error of a worker is the reason of the cancellation.
+	select {
+	case err := <-errs:
+		return 0, 0, err
+	default:
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rows, insertedRows.Load(), nil
+}
+
+// readBatches reads the CSV rows of r by batches of size rows and passes the values
+// of every batch to f. It returns the number of rows read.
+func readBatches(r io.Reader, fields int, size int, f func(args []interface{}) error) (int64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = fields
+	reader.ReuseRecord = true
+
+	var rows int64
+	args := make([]interface{}, 0, fields*size)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		for _, field := range record {
+			if field == NullField {
+				args = append(args, nil)
+			} else {
+				args = append(args, field)
+			}
+		}
+		rows++
+
+		if len(args) == cap(args) {
+			if err := f(args); err != nil {
+				return 0, err
+			}
+			args = make([]interface{}, 0, fields*size)
+		}
+	}
+
+	if len(args) > 0 {
+		if err := f(args); err != nil {
+			return 0, err
+		}
+	}
+
+	return rows, nil
+}
+
+// batchSize returns the number of rows of a batch of the fields.
+func (d *BatchDriver) batchSize(fields int) int {
+	size := d.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	if size*fields > maxBatchParams {
+		size = maxBatchParams / fields
+	}
+
+	return size
+}
+
+// insertQuery returns the INSERT of the rows into the columns of the table, skipping
+// the duplicates if ignore is set.
+func (d *BatchDriver) insertQuery(table string, columns string, fields int, rows int, ignore bool) string {
+	var query strings.Builder
+	query.WriteString("INSERT ")
+	if ignore && d.Dialect == "mysql" {
+		query.WriteString("IGNORE ")
+	}
+	query.WriteString("INTO " + table + " (" + columns + ") VALUES ")
+
+	for j := 0; j < rows; j++ {
+		if j > 0 {
+			query.WriteString(", ")
+		}
+
+		query.WriteString("(")
+		for k := 0; k < fields; k++ {
+			if k > 0 {
+				query.WriteString(", ")
+			}
+
+			if d.Dialect == "postgres" {
+				query.WriteString("$" + strconv.Itoa(j*fields+k+1))
+			} else {
+				query.WriteString("?")
+			}
+		}
+		query.WriteString(")")
+	}
+
+	if ignore && d.Dialect == "postgres" {
+		query.WriteString(" ON CONFLICT DO NOTHING")
+	}
+
+	return query.String()
+}
+
+func (d *BatchDriver) CreateSchema() error {
+	bulk, err := d.bulk()
+	if err != nil {
+		return err
+	}
+
+	return bulk.CreateSchema()
+}
+
+func (d *BatchDriver) Checkpoint(ctx context.Context, name string) (*Checkpoint, error) {
+	bulk, err := d.bulk()
+	if err != nil {
+		return nil, err
+	}
+
+	return bulk.Checkpoint(ctx, name)
+}
+
+func (d *BatchDriver) ClearCheckpoint(ctx context.Context, name string) error {
+	bulk, err := d.bulk()
+	if err != nil {
+		return err
+	}
+
+	return bulk.ClearCheckpoint(ctx, name)
+}
+
+// FallbackDriver loads by the bulk Driver until the server rejects it, and by Batch
+// from then on.
+type FallbackDriver struct {
+	Driver
+
+	Batch *BatchDriver
+
+	rejected atomic.Bool
+}
+
+// Load loads the file by the bulk driver, or by Batch if it's rejected.
+func (d *FallbackDriver) Load(ctx context.Context, path string, opts *LoadOptions) (*LoadResult, error) {
+	if !d.rejected.Load() {
+		result, err := d.Driver.Load(ctx, path, opts)
+		if !bulkRejected(err) {
+			return result, err
+		}
+
+		d.reject(err)
+	}
+
+	return d.Batch.Load(ctx, path, opts)
+}
+
+// LoadReader loads r by the bulk driver, or by Batch if it's rejected before r is
+// read. Once some of r is read, the rejection can't be recovered from.
+func (d *FallbackDriver) LoadReader(ctx context.Context, r io.Reader, opts *LoadOptions) (*LoadResult, error) {
+	if !d.rejected.Load() {
+		recorder := &readRecorder{r: r}
+		result, err := d.Driver.LoadReader(ctx, recorder, opts)
+		if !bulkRejected(err) || recorder.read {
+			return result, err
+		}
+
+		d.reject(err)
+	}
+
+	return d.Batch.LoadReader(ctx, r, opts)
+}
+
+func (d *FallbackDriver) reject(err error) {
+	d.rejected.Store(true)
+	logrus.Warnf("bulk load rejected, falling back to batch inserts: %v", err)
+}
+
+// bulkRejected reports whether the server rejected the bulk load: LOAD DATA LOCAL
+// INFILE is disabled on MySQL, or COPY isn't permitted or supported on Postgres.
+func bulkRejected(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_NOT_ALLOWED_COMMAND, ER_CLIENT_LOCAL_FILES_DISABLED and
+		// ER_LOAD_INFILE_CAPABILITY_DISABLED.
+		return mysqlErr.Number == 1148 || mysqlErr.Number == 3948 || mysqlErr.Number == 3950
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// insufficient_privilege and feature_not_supported.
+		return pqErr.Code == "42501" || pqErr.Code == "0A000"
+	}
+
+	return false
+}
+
+// readRecorder records whether anything was read from r, so the rejected bulk load
+// of r can be told apart from a failure halfway through. It's only read once the
+// load returns, unlike the reader counting the bytes of the progress, so it doesn't
+// need to be safe for concurrent use.
+type readRecorder struct {
+	r    io.Reader
+	read bool
+}
+
+func (c *readRecorder) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.read = true
+	}
+
+	return n, err
+}
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/suite"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type BatchTestSuite struct {
+	suite.Suite
+	db      *sql.DB
+	sqlMock sqlmock.Sqlmock
+}
+
+func (suite *BatchTestSuite) SetupTest() {
+	mockDB, sqlMock, err := sqlmock.New()
+	if err != nil {
+		log.Fatal("error in new connection", err)
+	}
+
+	suite.db = mockDB
+	suite.sqlMock = sqlMock
+}
+
+func (suite *BatchTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.sqlMock.ExpectationsWereMet())
+	_ = suite.db.Close()
+}
+
+// locationArgs returns the values of the rows j to k of locationRows.
+func locationArgs(j int, k int) []driver.Value {
+	var args []driver.Value
+	for ; j <= k; j++ {
+		args = append(args, "127.0.0."+strconv.Itoa(j), "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647")
+	}
+
+	return args
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_MySQL_Append_Success() {
+	require := suite.Require()
+	driver := &BatchDriver{DB: suite.db, Dialect: "mysql", BatchSize: 2}
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) VALUES (?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs(locationArgs(1, 2)...).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) VALUES (?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs(locationArgs(3, 3)...).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := driver.LoadReader(context.Background(), locationRows(3), nil)
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_MySQL_Append_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+	driver := &BatchDriver{DB: suite.db, Dialect: "mysql", BatchSize: 2}
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("INSERT IGNORE INTO locations (.+)").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	suite.sqlMock.ExpectExec("INSERT IGNORE INTO locations (.+)").
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+
+	_, err := driver.LoadReader(context.Background(), locationRows(3), nil)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_Postgres_Concurrency_Success() {
+	require := suite.Require()
+	driver := &BatchDriver{DB: suite.db, Dialect: "postgres", BatchSize: 1, Concurrency: 2}
+
+	suite.sqlMock.MatchExpectationsInOrder(false)
+	for j := 1; j <= 3; j++ {
+		suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT DO NOTHING")).
+			WithArgs(locationArgs(j, j)...).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	result, err := driver.LoadReader(context.Background(), locationRows(3), nil)
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 3}, result)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_Postgres_Concurrency_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+	driver := &BatchDriver{DB: suite.db, Dialect: "postgres", BatchSize: 2, Concurrency: 2}
+
+	suite.sqlMock.ExpectExec("INSERT INTO locations (.+)").
+		WillReturnError(errors.New("database error"))
+
+	_, err := driver.LoadReader(context.Background(), locationRows(2), nil)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_MySQL_Replace_Success() {
+	require := suite.Require()
+	driver := &BatchDriver{DB: suite.db, Dialect: "mysql"}
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging LIKE locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO locations_staging (ip_address,country_code,country,city,latitude,longitude,mystery_value) VALUES")).
+		WithArgs(locationArgs(1, 2)...).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_staging")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_old")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("RENAME TABLE locations TO locations_old, locations_staging TO locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE locations_old")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	result, err := driver.LoadReader(context.Background(), locationRows(2), &LoadOptions{Mode: ModeReplace})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_Postgres_Delta_Null_Success() {
+	require := suite.Require()
+	driver := &BatchDriver{DB: suite.db, Dialect: "postgres", Concurrency: 2}
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_delta")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations_delta (ip_address,country_code,country,city,latitude,longitude,mystery_value,operation,source_row) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)")).
+		WithArgs("127.0.0.4", nil, nil, nil, nil, nil, nil, "delete", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations_delta s USING locations_delta t")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_delta s WHERE s.operation = 'delete'")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations l USING locations_delta s")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations l USING locations k, locations_delta s")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE locations l SET")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) SELECT")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectCommit()
+
+	source := strings.NewReader("127.0.0.4,\\N,\\N,\\N,\\N,\\N,\\N,delete,1\n")
+	result, err := driver.LoadReader(context.Background(), source, &LoadOptions{Mode: ModeDelta})
+	require.NoError(err)
+	require.Equal(&LoadResult{Deleted: 1}, result)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_Checkpoint_Success() {
+	require := suite.Require()
+	driver := &BatchDriver{DB: suite.db, Dialect: "mysql", Concurrency: 2}
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("INSERT IGNORE INTO locations (.+)").
+		WithArgs(locationArgs(1, 2)...).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO import_checkpoints (name, source_offset, line, rows_read, rows_loaded) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE")).
+		WithArgs("data", 420, 6, 5, 6).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+
+	checkpoint := &Checkpoint{Name: "data", Offset: 420, Line: 6, Rows: 5, Loaded: 4}
+	result, err := driver.LoadReader(context.Background(), locationRows(2), &LoadOptions{Checkpoint: checkpoint})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *BatchTestSuite) TestBatch_LoadReader_Dialect_Failure() {
+	require := suite.Require()
+	expectedError := "invalid database driver"
+	driver := &BatchDriver{DB: suite.db, Dialect: "sqlite"}
+
+	_, err := driver.LoadReader(context.Background(), locationRows(1), nil)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *BatchTestSuite) TestBatch_batchSize() {
+	require := suite.Require()
+
+	require.Equal(1000, (&BatchDriver{}).batchSize(7))
+	require.Equal(9362, (&BatchDriver{BatchSize: 20000}).batchSize(7))
+}
+
+func (suite *BatchTestSuite) TestFallback_LoadReader_Rejected_Success() {
+	require := suite.Require()
+	driver := &FallbackDriver{
+		Driver: &MySQLDriver{DB: suite.db},
+		Batch:  &BatchDriver{DB: suite.db, Dialect: "mysql"},
+	}
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE (.+)").
+		WillReturnError(&mysql.MySQLError{Number: 3948, Message: "Loading local data is disabled"})
+	suite.sqlMock.ExpectRollback()
+	for j := 0; j < 2; j++ {
+		suite.sqlMock.ExpectBegin()
+		suite.sqlMock.ExpectExec("INSERT IGNORE INTO locations (.+)").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		suite.sqlMock.ExpectCommit()
+	}
+
+	// The second load goes straight to the batch driver.
+	for j := 0; j < 2; j++ {
+		result, err := driver.LoadReader(context.Background(), locationRows(1), nil)
+		require.NoError(err)
+		require.Equal(&LoadResult{Inserted: 1}, result)
+	}
+}
+
+func (suite *BatchTestSuite) TestFallback_LoadReader_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+	driver := &FallbackDriver{
+		Driver: &MySQLDriver{DB: suite.db},
+		Batch:  &BatchDriver{DB: suite.db, Dialect: "mysql"},
+	}
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE (.+)").
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+
+	_, err := driver.LoadReader(context.Background(), locationRows(1), nil)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *BatchTestSuite) TestFallback_bulkRejected() {
+	require := suite.Require()
+
+	require.True(bulkRejected(&mysql.MySQLError{Number: 1148}))
+	require.True(bulkRejected(&pq.Error{Code: "42501"}))
+	require.False(bulkRejected(&mysql.MySQLError{Number: 1062}))
+	require.False(bulkRejected(errors.New("database error")))
+	require.False(bulkRejected(nil))
+}
+
+func (suite *BatchTestSuite) TestDBConfig_NewDriver() {
+	require := suite.Require()
+
+	driver, err := (&DBConfig{Driver: "mysql"}).NewDriver(suite.db)
+	require.NoError(err)
+	require.IsType(&MySQLDriver{}, driver)
+
+	driver, err = (&DBConfig{Driver: "postgres", Load: LoadBatch, BatchSize: 500}).NewDriver(suite.db)
+	require.NoError(err)
+	require.Equal(&BatchDriver{DB: suite.db, Dialect: "postgres", BatchSize: 500}, driver)
+
+	driver, err = (&DBConfig{Driver: "mysql", Load: LoadAuto}).NewDriver(suite.db)
+	require.NoError(err)
+	require.IsType(&FallbackDriver{}, driver)
+
+	_, err = (&DBConfig{Driver: "mysql", Load: "copy"}).NewDriver(suite.db)
+	require.EqualError(err, "invalid load method")
+}
+
+func TestBatch(t *testing.T) {
+	suite.Run(t, new(BatchTestSuite))
+}
@@ -1,11 +1,14 @@
 package database
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	"io"
 	"net/url"
 	"time"
 
@@ -20,19 +23,46 @@ type DBConfig struct {
 	DB          string         `yaml:"DB"`
 	User        string         `yaml:"user"`
 	Password    string         `yaml:"password"`
-	Location    *time.Location `yaml:"location"`
+	Location    *time.Location `yaml:"-"`
 	MaxConn     int            `yaml:"max_conn"`
 	IdleConn    int            `yaml:"idle_conn"`
 	Timeout     time.Duration  `yaml:"timeout"`
 	DialRetry   int            `yaml:"dial_retry"`
 	DialTimeout time.Duration  `yaml:"dial_timeout"`
+
+	// LocationName is the IANA name of the location of the MySQL connection, e.g.
+	// Europe/Berlin, loaded when Location is nil. It's how the location is set in YAML.
+	LocationName string `yaml:"location"`
+
+	// Load is how the rows are loaded, LoadBulk by default.
+	Load             string `yaml:"load"`
+	BatchSize        int    `yaml:"batch_size"`
+	BatchConcurrency int    `yaml:"batch_concurrency"`
 }
 
+// The ways of loading the rows.
+const (
+	// LoadBulk loads by LOAD DATA LOCAL INFILE on MySQL and COPY on Postgres.
+	LoadBulk = "bulk"
+
+	// LoadBatch loads by multi-row INSERTs, see BatchDriver.
+	LoadBatch = "batch"
+
+	// LoadAuto loads by LoadBulk until the server rejects it, and by LoadBatch
+	// from then on.
+	LoadAuto = "auto"
+)
+
 // New returns DB struct
 func (d *DBConfig) New() (*sql.DB, error) {
 	switch d.Driver {
 	case "mysql":
-		return newMySQLConnection(d.mysqlDSN(), d.DialRetry, d.MaxConn, d.IdleConn, d.DialTimeout, d.Timeout)
+		dsn, err := d.mysqlDSN()
+		if err != nil {
+			return nil, err
+		}
+
+		return newMySQLConnection(dsn, d.DialRetry, d.MaxConn, d.IdleConn, d.DialTimeout, d.Timeout)
 	case "postgres":
 		return newPostgresSQLConnection(d.postgresqlDSN(), d.DialRetry, d.MaxConn, d.IdleConn, d.DialTimeout, d.Timeout)
 	default:
@@ -131,17 +161,167 @@ func newPostgresSQLConnection(
 	return db, nil
 }
 
-func (d *DBConfig) mysqlDSN() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true&collation=utf8mb4_general_ci&loc=%s", d.User, d.Password, d.Host, d.Port, d.DB, url.QueryEscape(d.Location.String()))
+func (d *DBConfig) mysqlDSN() (string, error) {
+	location := d.Location
+	if location == nil && d.LocationName != "" {
+		var err error
+		location, err = time.LoadLocation(d.LocationName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true&collation=utf8mb4_general_ci&loc=%s", d.User, d.Password, d.Host, d.Port, d.DB, url.QueryEscape(location.String())), nil
 }
 
 func (d *DBConfig) postgresqlDSN() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", d.User, url.QueryEscape(d.Password), d.Host, d.Port, d.DB)
 }
 
+// Mode selects how the loaded rows are applied to the locations table.
+type Mode int
+
+const (
+	// ModeAppend inserts the rows into locations, skipping the duplicates.
+	ModeAppend Mode = iota
+
+	// ModeReplace loads the rows into a staging table and, if it has enough rows,
+	// swaps it with locations atomically and drops the old table, so readers always
+	// see one consistent snapshot and stale rows are removed. Only one replace may
+	// run against a database at a time.
+	ModeReplace
+
+	// ModeUpsert keys the rows on the ip address: the locations of new ips are
+	// inserted and changed locations are updated in place, refreshing updated_at.
+	// The rows have a source_row column after the location columns, numbering them
+	// in the order they were read, and if an ip appears more than once in the rows,
+	// the one with the highest number wins whatever order they are loaded in. Other
+	// locations already stored for an ip in the rows are deleted.
+	ModeUpsert
+
+	// ModeDelta applies a delta file, which has an operation column after the
+	// location columns, in one transaction. "add" inserts the location of an ip
+	// that isn't stored, "update" changes the stored location of an ip in place
+	// like ModeUpsert, and "delete" removes the locations of an ip. A source_row
+	// column follows the operation, and like in ModeUpsert, if an ip appears more
+	// than once in a delta, only its row with the highest number is applied.
+	ModeDelta
+)
+
+// The operations of a delta file.
+const (
+	OperationAdd    = "add"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+const (
+	locationsTable = "locations"
+	stagingTable   = "locations_staging"
+	oldTable       = "locations_old"
+	upsertTable    = "locations_upsert"
+	deltaTable     = "locations_delta"
+	loadTable      = "locations_load"
+
+	checkpointsTable = "import_checkpoints"
+)
+
+// locationColumns are the columns loaded from the sanitized file.
+const locationColumns = "ip_address,country_code,country,city,latitude,longitude,mystery_value"
+
+// upsertColumns are the columns loaded from the sanitized file by ModeUpsert.
+const upsertColumns = locationColumns + ",source_row"
+
+// deltaColumns are the columns loaded from the sanitized file by ModeDelta.
+const deltaColumns = locationColumns + ",operation,source_row"
+
+// NullField is how NULL is written to the sanitized file.
+const NullField = `\N`
+
+// LoadOptions configures Driver.Load, nil means appending.
+type LoadOptions struct {
+	Mode Mode
+
+	// The least number of rows the staging table must have to be swapped in by
+	// ModeReplace. At least one row is always required, so an empty feed can't
+	// empty the table.
+	MinRows int64
+
+	// Checkpoint, if not nil, is saved in the same transaction as the loaded rows,
+	// so a resumed import never loads them twice. It's only supported by ModeAppend.
+	Checkpoint *Checkpoint
+}
+
+// Checkpoint is the position of a resumable import in its source, following the
+// last row loaded.
+type Checkpoint struct {
+	// Name identifies the import.
+	Name string
+
+	// The byte offset of the decompressed source.
+	Offset int64
+
+	// The line of the source the last loaded row starts on.
+	Line int64
+
+	// The number of rows read from the source.
+	Rows int64
+
+	// The number of rows loaded before this load. It's saved with the rows inserted
+	// by the load added.
+	Loaded int64
+}
+
+// LoadResult is returned by Driver.Load.
+type LoadResult struct {
+	// The number of rows inserted, by add operations in ModeDelta.
+	Inserted int64
+
+	// The number of rows updated by ModeUpsert, or by update operations in ModeDelta.
+	Updated int64
+
+	// The number of other locations of an ip deleted by ModeUpsert, or the number of
+	// ips deleted by delete operations in ModeDelta.
+	Deleted int64
+}
+
 type Driver interface {
-	Load(path string) (int64, error)
+	// Load loads the sanitized file.
+	Load(ctx context.Context, path string, opts *LoadOptions) (*LoadResult, error)
+
+	// LoadReader loads the sanitized rows read from r until EOF, so they can be
+	// streamed while they're sanitized without an intermediate file. Failing r
+	// fails the load.
+	LoadReader(ctx context.Context, r io.Reader, opts *LoadOptions) (*LoadResult, error)
+
 	CreateSchema() error
+
+	// Checkpoint returns the saved checkpoint of the import, nil if there is none.
+	// It creates the checkpoints table if it doesn't exist.
+	Checkpoint(ctx context.Context, name string) (*Checkpoint, error)
+
+	// ClearCheckpoint removes the saved checkpoint of a finished import.
+	ClearCheckpoint(ctx context.Context, name string) error
+}
+
+// NewDriver returns the driver loading the rows into db the way the config says.
+func (d *DBConfig) NewDriver(db *sql.DB) (Driver, error) {
+	bulk, err := New(d.Driver, db)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &BatchDriver{DB: db, Dialect: d.Driver, BatchSize: d.BatchSize, Concurrency: d.BatchConcurrency}
+	switch d.Load {
+	case "", LoadBulk:
+		return bulk, nil
+	case LoadBatch:
+		return batch, nil
+	case LoadAuto:
+		return &FallbackDriver{Driver: bulk, Batch: batch}, nil
+	}
+
+	return nil, errors.New("invalid load method")
 }
 
 func New(driver string, db *sql.DB) (Driver, error) {
@@ -155,87 +335,141 @@ func New(driver string, db *sql.DB) (Driver, error) {
 	return nil, errors.New("invalid database driver")
 }
 
-type MySQLDriver struct {
-	DB *sql.DB
+// loader fills the columns of the table with the sanitized rows of a load and returns
+// the number of rows inserted. It runs in tx, or in transactions of its own if tx is
+// nil. ignore skips the rows violating a unique constraint.
+type loader func(ctx context.Context, tx *sql.Tx, table string, columns string, ignore bool) (int64, error)
+
+// checkStagingRows validates the row count of the staging table before it's swapped in.
+func checkStagingRows(count int64, loaded int64, minRows int64) error {
+	if count != loaded {
+		return fmt.Errorf("staging table has %d rows but %d were loaded", count, loaded)
+	}
+
+	if minRows < 1 {
+		minRows = 1
+	}
+
+	if count < minRows {
+		return fmt.Errorf("staging table has %d rows, at least %d required", count, minRows)
+	}
+
+	return nil
 }
 
-func (d *MySQLDriver) Load(path string) (int64, error) {
-	mysql.RegisterLocalFile(path)
-	r, err := d.DB.Exec("LOAD DATA LOCAL INFILE '" + path + "' IGNORE INTO TABLE locations FIELDS TERMINATED BY \",\" LINES TERMINATED BY \"\\n\" (ip_address,country_code,country,city,latitude,longitude,mystery_value);")
-	if err != nil {
-		return 0, err
+// dropStaging removes a staging table after a failed load. It doesn't use the
+// context of the load, which may be the reason of the failure.
+func dropStaging(db *sql.DB, table string) {
+	if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+		logrus.Errorf("error dropping staging table: %v", err)
 	}
+}
+
+// uniqueTable returns the name of the table suffixed with random hex digits, so the
+// staging tables of concurrent loads never clash.
+func uniqueTable(table string) (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	return table + "_" + hex.EncodeToString(suffix), nil
+}
 
-	insertedRows, err := r.RowsAffected()
+// errCheckpointMode is returned when a checkpoint is saved by another mode than ModeAppend.
+var errCheckpointMode = errors.New("checkpoints are only supported in append mode")
+
+// queryCheckpoint reads the saved checkpoint of the import, nil if there is none.
+func queryCheckpoint(ctx context.Context, db *sql.DB, query string, name string) (*Checkpoint, error) {
+	checkpoint := Checkpoint{Name: name}
+	err := db.QueryRowContext(ctx, query, name).Scan(&checkpoint.Offset, &checkpoint.Line, &checkpoint.Rows, &checkpoint.Loaded)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return insertedRows, nil
+	return &checkpoint, nil
 }
 
-func (d *MySQLDriver) CreateSchema() error {
-	schema := `  CREATE TABLE IF NOT EXISTS locations (
-    id INT NOT NULL AUTO_INCREMENT,
-    ip_address VARCHAR(255) NOT NULL,
-    country_code VARCHAR(255) NOT NULL,
-    country  VARCHAR(255) NOT NULL,
-    city VARCHAR(255) NOT NULL,
-    latitude DOUBLE NOT NULL,
-    longitude DOUBLE NOT NULL,
-    mystery_value INT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    CONSTRAINT uc_location UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value),
-    PRIMARY KEY(id)
-)
-CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;`
+// loadCheckpointed loads the rows and saves the checkpoint in one transaction.
+func loadCheckpointed(ctx context.Context, db *sql.DB, load func(tx *sql.Tx) (int64, error), save string, checkpoint *Checkpoint) (*LoadResult, error) {
+	insertedRows, err := inTx(ctx, db, func(tx *sql.Tx) (int64, error) {
+		insertedRows, err := load(tx)
+		if err != nil {
+			return 0, err
+		}
 
-	_, err := d.DB.Exec(schema)
+		_, err = tx.ExecContext(ctx, save, checkpoint.Name, checkpoint.Offset, checkpoint.Line, checkpoint.Rows, checkpoint.Loaded+insertedRows)
+
+		return insertedRows, err
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &LoadResult{Inserted: insertedRows}, nil
+}
+
+// countDeletedQuery counts the ips of the delete operations in the delta table
+// that are stored.
+func countDeletedQuery(staging string) string {
+	return "SELECT COUNT(*) FROM " + staging + " s WHERE s.operation = '" + OperationDelete + "' " +
+		"AND EXISTS (SELECT 1 FROM " + locationsTable + " l WHERE l.ip_address = s.ip_address)"
+}
+
+// insertNewQuery inserts the locations of the ips in the staging table that aren't
+// stored, limited to the rows with the operation if it's not empty.
+func insertNewQuery(staging string, operation string) string {
+	return "INSERT INTO " + locationsTable + " (" + locationColumns + ") SELECT " + locationColumns + " FROM " + staging + " s " +
+		"WHERE NOT EXISTS (SELECT 1 FROM " + locationsTable + " l WHERE l.ip_address = s.ip_address)" +
+		operationCondition(operation, " AND ")
 }
 
-type PostgresDriver struct {
-	DB *sql.DB
+// operationCondition returns the condition on the operation of the staging rows
+// prefixed by the conjunction, or nothing if the operation is empty.
+func operationCondition(operation string, conjunction string) string {
+	if operation == "" {
+		return ""
+	}
+
+	return conjunction + "s.operation = '" + operation + "'"
 }
 
-// Load TODO: fix copy query
-func (d *PostgresDriver) Load(path string) (int64, error) {
-	r, err := d.DB.Exec("COPY locations(ip_address,country_code,country,city,latitude,longitude,mystery_value) FROM '" + path + "' DELIMITER ',' ;")
+// inTx runs f in a transaction and returns the number of rows it affected.
+func inTx(ctx context.Context, db *sql.DB, f func(tx *sql.Tx) (int64, error)) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
+	defer rollback(tx)
 
-	insertedRows, err := r.RowsAffected()
+	affected, err := f(tx)
 	if err != nil {
 		return 0, err
 	}
 
-	return insertedRows, nil
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return affected, nil
 }
 
-func (d *PostgresDriver) CreateSchema() error {
-	schema := `  CREATE TABLE IF NOT EXISTS locations (
-    id SERIAL PRIMARY KEY,
-    ip_address VARCHAR(255) NOT NULL,
-    country_code VARCHAR(255) NOT NULL,
-    country  VARCHAR(255) NOT NULL,
-    city VARCHAR(255) NOT NULL,
-    latitude DOUBLE precision NOT NULL,
-    longitude DOUBLE precision NOT NULL,
-    mystery_value INT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    CONSTRAINT uc_location UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value))`
+// rollback rolls tx back unless it's already committed.
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		logrus.Errorf("error rolling back transaction: %v", err)
+	}
+}
 
-	_, err := d.DB.Exec(schema)
+// execAffected runs the query and returns the number of affected rows.
+func execAffected(ctx context.Context, tx *sql.Tx, query string) (int64, error) {
+	r, err := tx.ExecContext(ctx, query)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return r.RowsAffected()
 }
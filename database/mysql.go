@@ -0,0 +1,354 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+	"io"
+	"strconv"
+	"sync/atomic"
+)
+
+type MySQLDriver struct {
+	DB *sql.DB
+}
+
+// readerHandlers numbers the reader handlers registered by LoadReader.
+var readerHandlers atomic.Int64
+
+// Load loads the file by LOAD DATA LOCAL INFILE.
+func (d *MySQLDriver) Load(ctx context.Context, path string, opts *LoadOptions) (*LoadResult, error) {
+	mysql.RegisterLocalFile(path)
+	defer mysql.DeregisterLocalFile(path)
+
+	return d.load(ctx, d.fileLoader(path), opts)
+}
+
+// LoadReader registers r as a reader handler and loads it by LOAD DATA LOCAL INFILE
+// 'Reader::<name>'.
+func (d *MySQLDriver) LoadReader(ctx context.Context, r io.Reader, opts *LoadOptions) (*LoadResult, error) {
+	name := "geoolocation_" + strconv.FormatInt(readerHandlers.Add(1), 10)
+	mysql.RegisterReaderHandler(name, func() io.Reader { return r })
+	defer mysql.DeregisterReaderHandler(name)
+
+	return d.load(ctx, d.fileLoader("Reader::"+name), opts)
+}
+
+// load loads the rows filled in by l.
+func (d *MySQLDriver) load(ctx context.Context, l loader, opts *LoadOptions) (*LoadResult, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+
+	if opts.Checkpoint != nil {
+		if opts.Mode != ModeAppend {
+			return nil, errCheckpointMode
+		}
+
+		return loadCheckpointed(ctx, d.DB, func(tx *sql.Tx) (int64, error) {
+			return l(ctx, tx, locationsTable, locationColumns, true)
+		}, mysqlSaveCheckpointQuery, opts.Checkpoint)
+	}
+
+	switch opts.Mode {
+	case ModeAppend:
+		// A failing reader leaves the rows read before the failure loaded, so they
+		// are only committed with the rest.
+		insertedRows, err := inTx(ctx, d.DB, func(tx *sql.Tx) (int64, error) {
+			return l(ctx, tx, locationsTable, locationColumns, true)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoadResult{Inserted: insertedRows}, nil
+	case ModeReplace:
+		return d.replace(ctx, l, opts.MinRows)
+	case ModeUpsert:
+		return d.upsert(ctx, l)
+	case ModeDelta:
+		return d.delta(ctx, l)
+	}
+
+	return nil, errors.New("invalid load mode")
+}
+
+// fileLoader loads the local file or reader handler named by path by LOAD DATA LOCAL
+// INFILE, which always skips the duplicates.
+func (d *MySQLDriver) fileLoader(path string) loader {
+	return func(ctx context.Context, tx *sql.Tx, table string, columns string, _ bool) (int64, error) {
+		if tx != nil {
+			return execAffected(ctx, tx, mysqlLoadQuery(path, table, columns))
+		}
+
+		r, err := d.DB.ExecContext(ctx, mysqlLoadQuery(path, table, columns))
+		if err != nil {
+			return 0, err
+		}
+
+		insertedRows, err := r.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		return insertedRows, nil
+	}
+}
+
+// mysqlLoadQuery loads the sanitized CSV file, whose fields are quoted if they contain
+// a comma, e.g. the rewritten "Korea, Republic of".
+func mysqlLoadQuery(path string, table string, columns string) string {
+	return "LOAD DATA LOCAL INFILE '" + path + "' IGNORE INTO TABLE " + table + " FIELDS TERMINATED BY \",\" OPTIONALLY ENCLOSED BY '\"' " +
+		"LINES TERMINATED BY \"\\n\" (" + columns + ");"
+}
+
+// replace loads the rows into the staging table and swaps it with locations by
+// RENAME TABLE, which is atomic.
+func (d *MySQLDriver) replace(ctx context.Context, l loader, minRows int64) (*LoadResult, error) {
+	if _, err := d.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+stagingTable); err != nil {
+		return nil, err
+	}
+
+	if _, err := d.DB.ExecContext(ctx, "CREATE TABLE "+stagingTable+" LIKE "+locationsTable); err != nil {
+		return nil, err
+	}
+
+	insertedRows, err := d.swap(ctx, l, minRows)
+	if err != nil {
+		dropStaging(d.DB, stagingTable)
+		return nil, err
+	}
+
+	if _, err := d.DB.ExecContext(ctx, "DROP TABLE "+oldTable); err != nil {
+		logrus.Errorf("error dropping old locations table: %v", err)
+	}
+
+	return &LoadResult{Inserted: insertedRows}, nil
+}
+
+func (d *MySQLDriver) swap(ctx context.Context, l loader, minRows int64) (int64, error) {
+	insertedRows, err := l(ctx, nil, stagingTable, locationColumns, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := d.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+stagingTable).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	if err := checkStagingRows(count, insertedRows, minRows); err != nil {
+		return 0, err
+	}
+
+	if _, err := d.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+oldTable); err != nil {
+		return 0, err
+	}
+
+	_, err = d.DB.ExecContext(ctx, "RENAME TABLE "+locationsTable+" TO "+oldTable+", "+stagingTable+" TO "+locationsTable)
+	if err != nil {
+		return 0, err
+	}
+
+	return insertedRows, nil
+}
+
+// upsert loads the rows into a staging table and applies it to locations in a
+// transaction. It's a regular table because MySQL can't refer to a temporary table
+// twice in a query, named uniquely so concurrent upserts don't share it.
+func (d *MySQLDriver) upsert(ctx context.Context, l loader) (*LoadResult, error) {
+	staging, err := uniqueTable(upsertTable)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unlike locations, it has no unique location, so LOAD DATA doesn't skip the
+	// later rows repeating an earlier location.
+	_, err = d.DB.ExecContext(ctx, "CREATE TABLE "+staging+" ("+
+		"ip_address VARCHAR(255) NOT NULL, country_code VARCHAR(255) NOT NULL, country VARCHAR(255) NOT NULL, "+
+		"city VARCHAR(255) NOT NULL, latitude DOUBLE NOT NULL, longitude DOUBLE NOT NULL, mystery_value INT NOT NULL, "+
+		"source_row BIGINT NOT NULL, PRIMARY KEY(source_row), INDEX(ip_address)) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci")
+	if err != nil {
+		return nil, err
+	}
+	defer dropStaging(d.DB, staging)
+
+	if _, err := l(ctx, nil, staging, upsertColumns, true); err != nil {
+		return nil, err
+	}
+
+	// The rows read later win.
+	_, err = d.DB.ExecContext(ctx, "DELETE s FROM "+staging+" s JOIN "+staging+" t ON s.ip_address = t.ip_address AND s.source_row < t.source_row")
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	var result LoadResult
+	result.Deleted, err = execAffected(ctx, tx, mysqlCollapseQuery(staging, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Updated, err = execAffected(ctx, tx, mysqlUpdateQuery(staging, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Inserted, err = execAffected(ctx, tx, insertNewQuery(staging, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// delta loads the delta rows into a staging table and applies its operations to
+// locations in one transaction. Like in upsert, the table is named uniquely.
+func (d *MySQLDriver) delta(ctx context.Context, l loader) (*LoadResult, error) {
+	staging, err := uniqueTable(deltaTable)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.DB.ExecContext(ctx, "CREATE TABLE "+staging+" ("+
+		"operation VARCHAR(16) NOT NULL, ip_address VARCHAR(255) NOT NULL, "+
+		"country_code VARCHAR(255), country VARCHAR(255), city VARCHAR(255), latitude DOUBLE, longitude DOUBLE, "+
+		"mystery_value INT, source_row BIGINT NOT NULL, PRIMARY KEY(source_row), INDEX(ip_address)) "+
+		"CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci")
+	if err != nil {
+		return nil, err
+	}
+	defer dropStaging(d.DB, staging)
+
+	if _, err := l(ctx, nil, staging, deltaColumns, true); err != nil {
+		return nil, err
+	}
+
+	// The rows read later win.
+	_, err = d.DB.ExecContext(ctx, "DELETE s FROM "+staging+" s JOIN "+staging+" t ON s.ip_address = t.ip_address AND s.source_row < t.source_row")
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	var result LoadResult
+	err = tx.QueryRowContext(ctx, countDeletedQuery(staging)).Scan(&result.Deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE l FROM "+locationsTable+" l JOIN "+staging+" s ON l.ip_address = s.ip_address "+
+		"WHERE s.operation = '"+OperationDelete+"'"); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, mysqlCollapseQuery(staging, OperationUpdate)); err != nil {
+		return nil, err
+	}
+
+	result.Updated, err = execAffected(ctx, tx, mysqlUpdateQuery(staging, OperationUpdate))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Inserted, err = execAffected(ctx, tx, insertNewQuery(staging, OperationAdd))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// mysqlCollapseQuery deletes all but the first location of the ips in the staging
+// table, limited to the rows with the operation if it's not empty.
+func mysqlCollapseQuery(staging string, operation string) string {
+	return "DELETE l FROM " + locationsTable + " l JOIN " + locationsTable + " k ON l.ip_address = k.ip_address AND k.id < l.id " +
+		"JOIN " + staging + " s ON l.ip_address = s.ip_address" + operationCondition(operation, " WHERE ")
+}
+
+// mysqlUpdateQuery updates the changed locations of the ips in the staging table,
+// limited to the rows with the operation if it's not empty. updated_at is set by the
+// query, as the schema doesn't refresh it on update, like on Postgres.
+func mysqlUpdateQuery(staging string, operation string) string {
+	return "UPDATE " + locationsTable + " l JOIN " + staging + " s ON l.ip_address = s.ip_address " +
+		"SET l.country_code = s.country_code, l.country = s.country, l.city = s.city, l.latitude = s.latitude, " +
+		"l.longitude = s.longitude, l.mystery_value = s.mystery_value, l.updated_at = CURRENT_TIMESTAMP " +
+		"WHERE NOT (l.country_code <=> s.country_code AND l.country <=> s.country AND l.city <=> s.city AND " +
+		"l.latitude <=> s.latitude AND l.longitude <=> s.longitude AND l.mystery_value <=> s.mystery_value)" +
+		operationCondition(operation, " AND ")
+}
+
+const mysqlSaveCheckpointQuery = "INSERT INTO " + checkpointsTable + " (name, source_offset, line, rows_read, rows_loaded) VALUES (?, ?, ?, ?, ?) " +
+	"ON DUPLICATE KEY UPDATE source_offset = VALUES(source_offset), line = VALUES(line), rows_read = VALUES(rows_read), " +
+	"rows_loaded = VALUES(rows_loaded), updated_at = CURRENT_TIMESTAMP"
+
+func (d *MySQLDriver) Checkpoint(ctx context.Context, name string) (*Checkpoint, error) {
+	schema := `CREATE TABLE IF NOT EXISTS ` + checkpointsTable + ` (
+    name VARCHAR(255) NOT NULL,
+    source_offset BIGINT NOT NULL,
+    line BIGINT NOT NULL,
+    rows_read BIGINT NOT NULL,
+    rows_loaded BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(name)
+)
+CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;`
+
+	if _, err := d.DB.ExecContext(ctx, schema); err != nil {
+		return nil, err
+	}
+
+	return queryCheckpoint(ctx, d.DB, "SELECT source_offset, line, rows_read, rows_loaded FROM "+checkpointsTable+" WHERE name = ?", name)
+}
+
+func (d *MySQLDriver) ClearCheckpoint(ctx context.Context, name string) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM "+checkpointsTable+" WHERE name = ?", name)
+
+	return err
+}
+
+func (d *MySQLDriver) CreateSchema() error {
+	schema := `  CREATE TABLE IF NOT EXISTS locations (
+    id INT NOT NULL AUTO_INCREMENT,
+    ip_address VARCHAR(255) NOT NULL,
+    country_code VARCHAR(255) NOT NULL,
+    country  VARCHAR(255) NOT NULL,
+    city VARCHAR(255) NOT NULL,
+    latitude DOUBLE NOT NULL,
+    longitude DOUBLE NOT NULL,
+    mystery_value INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uc_location UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value),
+    PRIMARY KEY(id)
+)
+CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci;`
+
+	_, err := d.DB.Exec(schema)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
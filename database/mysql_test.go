@@ -0,0 +1,305 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/yaml.v3"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type MySQLTestSuite struct {
+	suite.Suite
+	db      *sql.DB
+	sqlMock sqlmock.Sqlmock
+	driver  *MySQLDriver
+}
+
+func (suite *MySQLTestSuite) SetupTest() {
+	mockDB, sqlMock, err := sqlmock.New()
+	if err != nil {
+		log.Fatal("error in new connection", err)
+	}
+
+	suite.db = mockDB
+	suite.sqlMock = sqlMock
+	suite.driver = &MySQLDriver{DB: mockDB}
+}
+
+func (suite *MySQLTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.sqlMock.ExpectationsWereMet())
+	_ = suite.db.Close()
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Append_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.driver.Load(context.Background(), "data.csv", nil)
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_LoadReader_Append_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'Reader::geoolocation_[0-9]+' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.driver.LoadReader(context.Background(), strings.NewReader(""), nil)
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_LoadReader_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'Reader::geoolocation_[0-9]+' IGNORE INTO TABLE locations (.+)").
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+
+	_, err := suite.driver.LoadReader(context.Background(), strings.NewReader(""), nil)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Replace_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging LIKE locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_staging (.+)").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_staging")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_old")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("RENAME TABLE locations TO locations_old, locations_staging TO locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE locations_old")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	result, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeReplace, MinRows: 2})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Replace_MinRows_Failure() {
+	require := suite.Require()
+	expectedError := "staging table has 2 rows, at least 3 required"
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging LIKE locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_staging (.+)").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_staging")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeReplace, MinRows: 3})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Replace_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging LIKE locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_staging (.+)").
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeReplace})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Upsert_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectExec("CREATE TABLE locations_upsert_[0-9a-f]{16} \\(ip_address (.+), source_row BIGINT NOT NULL, PRIMARY KEY\\(source_row\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_upsert_[0-9a-f]{16} (.+) \\(ip_address,country_code,country,city,latitude,longitude,mystery_value,source_row\\);").
+		WillReturnResult(sqlmock.NewResult(4, 4))
+	suite.sqlMock.ExpectExec("DELETE s FROM locations_upsert_[0-9a-f]{16} s JOIN locations_upsert_[0-9a-f]{16} t ON s.ip_address = t.ip_address AND s.source_row < t.source_row").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE l FROM locations l JOIN locations k ON l.ip_address = k.ip_address AND k.id < l.id JOIN locations_upsert_")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec("UPDATE locations l JOIN locations_upsert_[0-9a-f]{16} s ON l.ip_address = s.ip_address SET (.+), l.updated_at = CURRENT_TIMESTAMP WHERE").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) SELECT")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectExec("DROP TABLE IF EXISTS locations_upsert_[0-9a-f]{16}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	result, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeUpsert})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 1, Updated: 2, Deleted: 1}, result)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Upsert_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectExec("CREATE TABLE locations_upsert_[0-9a-f]{16} \\(ip_address (.+), source_row BIGINT NOT NULL, PRIMARY KEY\\(source_row\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_upsert_[0-9a-f]{16} (.+)").
+		WillReturnResult(sqlmock.NewResult(4, 4))
+	suite.sqlMock.ExpectExec("DELETE s FROM locations_upsert_[0-9a-f]{16} s").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE l FROM locations l")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE locations l")).
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+	suite.sqlMock.ExpectExec("DROP TABLE IF EXISTS locations_upsert_[0-9a-f]{16}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeUpsert})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Delta_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectExec("CREATE TABLE locations_delta_[0-9a-f]{16} \\(operation (.+), source_row BIGINT NOT NULL, PRIMARY KEY\\(source_row\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_delta_[0-9a-f]{16} (.+) \\(ip_address,country_code,country,city,latitude,longitude,mystery_value,operation,source_row\\);").
+		WillReturnResult(sqlmock.NewResult(5, 5))
+	suite.sqlMock.ExpectExec("DELETE s FROM locations_delta_[0-9a-f]{16} s JOIN locations_delta_[0-9a-f]{16} t ON s.ip_address = t.ip_address AND s.source_row < t.source_row").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM locations_delta_[0-9a-f]{16} s WHERE s.operation = 'delete'").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectExec("DELETE l FROM locations l JOIN locations_delta_[0-9a-f]{16} s ON l.ip_address = s.ip_address WHERE s.operation = 'delete'").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	suite.sqlMock.ExpectExec("DELETE l FROM locations l JOIN locations k ON l.ip_address = k.ip_address AND k.id < l.id JOIN locations_delta_[0-9a-f]{16} s ON l.ip_address = s.ip_address WHERE s.operation = 'update'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("UPDATE locations l JOIN locations_delta_[0-9a-f]{16} s ON l.ip_address = s.ip_address SET").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) SELECT")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectExec("DROP TABLE IF EXISTS locations_delta_[0-9a-f]{16}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	result, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeDelta})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 1, Updated: 1, Deleted: 2}, result)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Delta_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectExec("CREATE TABLE locations_delta_[0-9a-f]{16} \\(operation (.+), source_row BIGINT NOT NULL, PRIMARY KEY\\(source_row\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations_delta_[0-9a-f]{16} (.+)").
+		WillReturnResult(sqlmock.NewResult(5, 5))
+	suite.sqlMock.ExpectExec("DELETE s FROM locations_delta_[0-9a-f]{16} s").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM locations_delta_[0-9a-f]{16}").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	suite.sqlMock.ExpectExec("DELETE l FROM locations l JOIN locations_delta_[0-9a-f]{16} s").
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+	suite.sqlMock.ExpectExec("DROP TABLE IF EXISTS locations_delta_[0-9a-f]{16}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeDelta})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Checkpoint_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'data.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(3, 3))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO import_checkpoints (name, source_offset, line, rows_read, rows_loaded) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE")).
+		WithArgs("data", 420, 6, 5, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+
+	checkpoint := &Checkpoint{Name: "data", Offset: 420, Line: 6, Rows: 5, Loaded: 4}
+	result, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Checkpoint: checkpoint})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 3}, result)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Load_Checkpoint_Mode_Failure() {
+	require := suite.Require()
+	expectedError := "checkpoints are only supported in append mode"
+
+	_, err := suite.driver.Load(context.Background(), "data.csv", &LoadOptions{Mode: ModeReplace, Checkpoint: &Checkpoint{Name: "data"}})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_Checkpoint_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS import_checkpoints")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT source_offset, line, rows_read, rows_loaded FROM import_checkpoints WHERE name = ?")).
+		WithArgs("data").
+		WillReturnRows(sqlmock.NewRows([]string{"source_offset", "line", "rows_read", "rows_loaded"}).AddRow(420, 6, 5, 7))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM import_checkpoints WHERE name = ?")).
+		WithArgs("data").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	checkpoint, err := suite.driver.Checkpoint(context.Background(), "data")
+	require.NoError(err)
+	require.Equal(&Checkpoint{Name: "data", Offset: 420, Line: 6, Rows: 5, Loaded: 7}, checkpoint)
+
+	err = suite.driver.ClearCheckpoint(context.Background(), "data")
+	require.NoError(err)
+}
+
+func (suite *MySQLTestSuite) TestMySQL_mysqlDSN_Location() {
+	require := suite.Require()
+
+	var config DBConfig
+	require.NoError(yaml.Unmarshal([]byte("driver: mysql\nlocation: Europe/Berlin\n"), &config))
+	require.Equal("Europe/Berlin", config.LocationName)
+
+	dsn, err := config.mysqlDSN()
+	require.NoError(err)
+	require.True(strings.HasSuffix(dsn, "&loc=Europe%2FBerlin"))
+
+	config.LocationName = ""
+	dsn, err = config.mysqlDSN()
+	require.NoError(err)
+	require.True(strings.HasSuffix(dsn, "&loc=UTC"))
+
+	config.LocationName = "Mars/Olympus"
+	_, err = config.mysqlDSN()
+	require.Error(err)
+}
+
+func TestMySQL(t *testing.T) {
+	suite.Run(t, new(MySQLTestSuite))
+}
@@ -0,0 +1,412 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strings"
+)
+
+type PostgresDriver struct {
+	DB *sql.DB
+}
+
+// Load copies the file from the client, see LoadReader.
+func (d *PostgresDriver) Load(ctx context.Context, path string, opts *LoadOptions) (*LoadResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return d.LoadReader(ctx, file, opts)
+}
+
+// LoadReader streams the sanitized rows to the server with the client-side COPY
+// protocol, so neither superuser nor a file on the database host is needed.
+func (d *PostgresDriver) LoadReader(ctx context.Context, r io.Reader, opts *LoadOptions) (*LoadResult, error) {
+	return d.load(ctx, d.copyLoader(r), opts)
+}
+
+// load loads the rows filled in by l.
+func (d *PostgresDriver) load(ctx context.Context, l loader, opts *LoadOptions) (*LoadResult, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+
+	if opts.Checkpoint != nil {
+		if opts.Mode != ModeAppend {
+			return nil, errCheckpointMode
+		}
+
+		return loadCheckpointed(ctx, d.DB, func(tx *sql.Tx) (int64, error) {
+			return l(ctx, tx, locationsTable, locationColumns, true)
+		}, postgresSaveCheckpointQuery, opts.Checkpoint)
+	}
+
+	switch opts.Mode {
+	case ModeAppend:
+		insertedRows, err := l(ctx, nil, locationsTable, locationColumns, true)
+		if err != nil {
+			return nil, err
+		}
+
+		return &LoadResult{Inserted: insertedRows}, nil
+	case ModeReplace:
+		return d.replace(ctx, l, opts.MinRows)
+	case ModeUpsert:
+		return d.upsert(ctx, l)
+	case ModeDelta:
+		return d.delta(ctx, l)
+	}
+
+	return nil, errors.New("invalid load mode")
+}
+
+// copyLoader copies the rows of r, through copyIgnore if the duplicates are skipped.
+func (d *PostgresDriver) copyLoader(r io.Reader) loader {
+	return func(ctx context.Context, tx *sql.Tx, table string, columns string, ignore bool) (int64, error) {
+		if tx == nil {
+			return inTx(ctx, d.DB, func(tx *sql.Tx) (int64, error) {
+				return d.copyLoader(r)(ctx, tx, table, columns, ignore)
+			})
+		}
+
+		if ignore {
+			return copyIgnore(ctx, tx, r, table)
+		}
+
+		return copyFrom(ctx, tx, r, table, columns)
+	}
+}
+
+// copyFrom copies the CSV rows of r into the columns of the table in tx. `\N` is
+// copied as NULL.
+func copyFrom(ctx context.Context, tx *sql.Tx, r io.Reader, table string, columns string) (int64, error) {
+	names := strings.Split(columns, ",")
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, names...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(names)
+	reader.ReuseRecord = true
+
+	values := make([]interface{}, len(names))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		for j, field := range record {
+			if field == NullField {
+				values[j] = nil
+			} else {
+				values[j] = field
+			}
+		}
+
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// copyIgnore copies the rows into a temporary table and inserts them into the table
+// in tx, skipping the duplicates like IGNORE does on MySQL. It returns the number of
+// rows inserted.
+func copyIgnore(ctx context.Context, tx *sql.Tx, r io.Reader, table string) (int64, error) {
+	_, err := tx.ExecContext(ctx, "CREATE TEMPORARY TABLE "+loadTable+" ON COMMIT DROP AS SELECT "+locationColumns+" FROM "+locationsTable+" WITH NO DATA")
+	if err != nil {
+		return 0, err
+	}
+
+	copiedRows, err := copyFrom(ctx, tx, r, loadTable, locationColumns)
+	if err != nil {
+		return 0, err
+	}
+
+	insertedRows, err := execAffected(ctx, tx, "INSERT INTO "+table+" ("+locationColumns+") SELECT "+locationColumns+" FROM "+loadTable+" ON CONFLICT DO NOTHING")
+	if err != nil {
+		return 0, err
+	}
+
+	if duplicates := copiedRows - insertedRows; duplicates > 0 {
+		logrus.Infof("%d duplicate rows skipped", duplicates)
+	}
+
+	return insertedRows, nil
+}
+
+// replace copies the rows into the staging table and swaps it with locations by
+// renaming both in a transaction.
+func (d *PostgresDriver) replace(ctx context.Context, l loader, minRows int64) (*LoadResult, error) {
+	if _, err := d.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+stagingTable); err != nil {
+		return nil, err
+	}
+
+	// The constraints are named explicitly, so swap can give them the names of the
+	// constraints of locations back.
+	_, err := d.DB.ExecContext(ctx, "CREATE TABLE "+stagingTable+" (LIKE "+locationsTable+" INCLUDING DEFAULTS, "+
+		"CONSTRAINT "+stagingPkey+" PRIMARY KEY (id), CONSTRAINT "+stagingUniqueLocation+" UNIQUE ("+locationColumns+"))")
+	if err != nil {
+		return nil, err
+	}
+
+	insertedRows, err := d.swap(ctx, l, minRows)
+	if err != nil {
+		dropStaging(d.DB, stagingTable)
+		return nil, err
+	}
+
+	return &LoadResult{Inserted: insertedRows}, nil
+}
+
+func (d *PostgresDriver) swap(ctx context.Context, l loader, minRows int64) (int64, error) {
+	insertedRows, err := l(ctx, nil, stagingTable, locationColumns, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := d.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+stagingTable).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	if err := checkStagingRows(count, insertedRows, minRows); err != nil {
+		return 0, err
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(tx)
+
+	// The staging table shares the id sequence of locations, which has to be moved to
+	// the new table before the old one can be dropped, freeing the names of its
+	// constraints.
+	for _, query := range []string{
+		"ALTER TABLE " + locationsTable + " RENAME TO " + oldTable,
+		"ALTER TABLE " + stagingTable + " RENAME TO " + locationsTable,
+		"ALTER SEQUENCE " + locationsTable + "_id_seq OWNED BY " + locationsTable + ".id",
+		"DROP TABLE " + oldTable,
+		"ALTER TABLE " + locationsTable + " RENAME CONSTRAINT " + stagingPkey + " TO " + locationsPkey,
+		"ALTER TABLE " + locationsTable + " RENAME CONSTRAINT " + stagingUniqueLocation + " TO " + uniqueLocation,
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return insertedRows, nil
+}
+
+// upsert copies the rows into a temporary table and applies it to locations in
+// one transaction.
+func (d *PostgresDriver) upsert(ctx context.Context, l loader) (*LoadResult, error) {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	// It has no id, which would take its default from the sequence of locations.
+	_, err = tx.ExecContext(ctx, "CREATE TEMPORARY TABLE "+upsertTable+" ("+
+		"ip_address VARCHAR(255) NOT NULL, country_code VARCHAR(255) NOT NULL, country VARCHAR(255) NOT NULL, "+
+		"city VARCHAR(255) NOT NULL, latitude DOUBLE precision NOT NULL, longitude DOUBLE precision NOT NULL, "+
+		"mystery_value INT NOT NULL, source_row BIGINT PRIMARY KEY) ON COMMIT DROP")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := l(ctx, tx, upsertTable, upsertColumns, false); err != nil {
+		return nil, err
+	}
+
+	// The rows read later win.
+	_, err = tx.ExecContext(ctx, "DELETE FROM "+upsertTable+" s USING "+upsertTable+" t WHERE s.ip_address = t.ip_address AND s.source_row < t.source_row")
+	if err != nil {
+		return nil, err
+	}
+
+	var result LoadResult
+	result.Deleted, err = execAffected(ctx, tx, postgresCollapseQuery(upsertTable, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Updated, err = execAffected(ctx, tx, postgresUpdateQuery(upsertTable, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Inserted, err = execAffected(ctx, tx, insertNewQuery(upsertTable, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// delta copies the delta rows into a temporary table and applies its operations to
+// locations in one transaction.
+func (d *PostgresDriver) delta(ctx context.Context, l loader) (*LoadResult, error) {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx)
+
+	_, err = tx.ExecContext(ctx, "CREATE TEMPORARY TABLE "+deltaTable+" ("+
+		"operation VARCHAR(16) NOT NULL, ip_address VARCHAR(255) NOT NULL, "+
+		"country_code VARCHAR(255), country VARCHAR(255), city VARCHAR(255), latitude DOUBLE precision, "+
+		"longitude DOUBLE precision, mystery_value INT, source_row BIGINT PRIMARY KEY) ON COMMIT DROP")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := l(ctx, tx, deltaTable, deltaColumns, false); err != nil {
+		return nil, err
+	}
+
+	// The rows read later win.
+	_, err = tx.ExecContext(ctx, "DELETE FROM "+deltaTable+" s USING "+deltaTable+" t WHERE s.ip_address = t.ip_address AND s.source_row < t.source_row")
+	if err != nil {
+		return nil, err
+	}
+
+	var result LoadResult
+	err = tx.QueryRowContext(ctx, countDeletedQuery(deltaTable)).Scan(&result.Deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+locationsTable+" l USING "+deltaTable+" s "+
+		"WHERE l.ip_address = s.ip_address AND s.operation = '"+OperationDelete+"'"); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, postgresCollapseQuery(deltaTable, OperationUpdate)); err != nil {
+		return nil, err
+	}
+
+	result.Updated, err = execAffected(ctx, tx, postgresUpdateQuery(deltaTable, OperationUpdate))
+	if err != nil {
+		return nil, err
+	}
+
+	result.Inserted, err = execAffected(ctx, tx, insertNewQuery(deltaTable, OperationAdd))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// postgresCollapseQuery deletes all but the first location of the ips in the staging
+// table, limited to the rows with the operation if it's not empty.
+func postgresCollapseQuery(staging string, operation string) string {
+	return "DELETE FROM " + locationsTable + " l USING " + locationsTable + " k, " + staging + " s " +
+		"WHERE l.ip_address = k.ip_address AND k.id < l.id AND l.ip_address = s.ip_address" +
+		operationCondition(operation, " AND ")
+}
+
+// postgresUpdateQuery updates the changed locations of the ips in the staging table,
+// limited to the rows with the operation if it's not empty.
+func postgresUpdateQuery(staging string, operation string) string {
+	return "UPDATE " + locationsTable + " l " +
+		"SET country_code = s.country_code, country = s.country, city = s.city, latitude = s.latitude, " +
+		"longitude = s.longitude, mystery_value = s.mystery_value, updated_at = CURRENT_TIMESTAMP " +
+		"FROM " + staging + " s WHERE l.ip_address = s.ip_address AND " +
+		"(l.country_code, l.country, l.city, l.latitude, l.longitude, l.mystery_value) IS DISTINCT FROM " +
+		"(s.country_code, s.country, s.city, s.latitude, s.longitude, s.mystery_value)" +
+		operationCondition(operation, " AND ")
+}
+
+// The names of the constraints of locations and of the staging table of replace.
+const (
+	locationsPkey         = locationsTable + "_pkey"
+	uniqueLocation        = "uc_location"
+	stagingPkey           = stagingTable + "_pkey"
+	stagingUniqueLocation = uniqueLocation + "_staging"
+)
+
+const postgresSaveCheckpointQuery = "INSERT INTO " + checkpointsTable + " (name, source_offset, line, rows_read, rows_loaded) VALUES ($1, $2, $3, $4, $5) " +
+	"ON CONFLICT (name) DO UPDATE SET source_offset = EXCLUDED.source_offset, line = EXCLUDED.line, rows_read = EXCLUDED.rows_read, " +
+	"rows_loaded = EXCLUDED.rows_loaded, updated_at = CURRENT_TIMESTAMP"
+
+func (d *PostgresDriver) Checkpoint(ctx context.Context, name string) (*Checkpoint, error) {
+	schema := `CREATE TABLE IF NOT EXISTS ` + checkpointsTable + ` (
+    name VARCHAR(255) PRIMARY KEY,
+    source_offset BIGINT NOT NULL,
+    line BIGINT NOT NULL,
+    rows_read BIGINT NOT NULL,
+    rows_loaded BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)`
+
+	if _, err := d.DB.ExecContext(ctx, schema); err != nil {
+		return nil, err
+	}
+
+	return queryCheckpoint(ctx, d.DB, "SELECT source_offset, line, rows_read, rows_loaded FROM "+checkpointsTable+" WHERE name = $1", name)
+}
+
+func (d *PostgresDriver) ClearCheckpoint(ctx context.Context, name string) error {
+	_, err := d.DB.ExecContext(ctx, "DELETE FROM "+checkpointsTable+" WHERE name = $1", name)
+
+	return err
+}
+
+func (d *PostgresDriver) CreateSchema() error {
+	schema := `  CREATE TABLE IF NOT EXISTS locations (
+    id SERIAL PRIMARY KEY,
+    ip_address VARCHAR(255) NOT NULL,
+    country_code VARCHAR(255) NOT NULL,
+    country  VARCHAR(255) NOT NULL,
+    city VARCHAR(255) NOT NULL,
+    latitude DOUBLE precision NOT NULL,
+    longitude DOUBLE precision NOT NULL,
+    mystery_value INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uc_location UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value))`
+
+	_, err := d.DB.Exec(schema)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
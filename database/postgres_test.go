@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type PostgresTestSuite struct {
+	suite.Suite
+	db      *sql.DB
+	sqlMock sqlmock.Sqlmock
+	driver  *PostgresDriver
+}
+
+func (suite *PostgresTestSuite) SetupTest() {
+	mockDB, sqlMock, err := sqlmock.New()
+	if err != nil {
+		log.Fatal("error in new connection", err)
+	}
+
+	suite.db = mockDB
+	suite.sqlMock = sqlMock
+	suite.driver = &PostgresDriver{DB: mockDB}
+}
+
+func (suite *PostgresTestSuite) TearDownTest() {
+	suite.Require().NoError(suite.sqlMock.ExpectationsWereMet())
+	_ = suite.db.Close()
+}
+
+// deltaRows are sanitized delta rows, the last ones are deletes.
+const deltaRows = "127.0.0.1,TA,test,test,48.92021642445653,14.900399560492929,2147483647,add,1\n" +
+	"127.0.0.2,TA,test,test,48.92021642445653,14.900399560492929,2147483647,update,2\n" +
+	"127.0.0.3,TA,test,test,48.92021642445653,14.900399560492929,2147483647,update,3\n" +
+	"127.0.0.4,\\N,\\N,\\N,\\N,\\N,\\N,delete,4\n" +
+	"127.0.0.5,\\N,\\N,\\N,\\N,\\N,\\N,delete,5\n"
+
+const upsertRows = "127.0.0.1,TA,test,test,48.92021642445653,14.900399560492929,2147483647,1\n" +
+	"127.0.0.2,TA,test,test,48.92021642445653,14.900399560492929,2147483647,2\n" +
+	"127.0.0.1,TB,test,test,48.92021642445653,14.900399560492929,2147483647,3\n"
+
+// locationRows returns n sanitized rows.
+func locationRows(n int) io.Reader {
+	var rows strings.Builder
+	for j := 0; j < n; j++ {
+		rows.WriteString(fmt.Sprintf("127.0.0.%d,TA,test,test,48.92021642445653,14.900399560492929,2147483647\n", j+1))
+	}
+
+	return strings.NewReader(rows.String())
+}
+
+// expectCopyIgnore expects the rows to be copied into a temporary table and inserted
+// into the table without the duplicates.
+func (suite *PostgresTestSuite) expectCopyIgnore(table string, rows int64, inserted int64) {
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_load ON COMMIT DROP AS SELECT ip_address,country_code,country,city,latitude,longitude,mystery_value FROM locations WITH NO DATA")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.expectCopy("locations_load", rows)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO " + table + " (ip_address,country_code,country,city,latitude,longitude,mystery_value) SELECT ip_address,country_code,country,city,latitude,longitude,mystery_value FROM locations_load ON CONFLICT DO NOTHING")).
+		WillReturnResult(sqlmock.NewResult(0, inserted))
+}
+
+// expectCopy expects the rows to be copied into the table.
+func (suite *PostgresTestSuite) expectCopy(table string, rows int64) {
+	prepare := suite.sqlMock.ExpectPrepare(regexp.QuoteMeta(`COPY "` + table + `" ("ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"`))
+	for j := int64(0); j < rows; j++ {
+		prepare.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	prepare.ExpectExec().WillReturnResult(sqlmock.NewResult(0, rows))
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Replace_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging (LIKE locations INCLUDING DEFAULTS, CONSTRAINT locations_staging_pkey PRIMARY KEY (id), " +
+		"CONSTRAINT uc_location_staging UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value))")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.expectCopyIgnore("locations_staging", 2, 2)
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_staging")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("ALTER TABLE locations RENAME TO locations_old")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("ALTER TABLE locations_staging RENAME TO locations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("ALTER SEQUENCE locations_id_seq OWNED BY locations.id")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE locations_old")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("ALTER TABLE locations RENAME CONSTRAINT locations_staging_pkey TO locations_pkey")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("ALTER TABLE locations RENAME CONSTRAINT uc_location_staging TO uc_location")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.driver.LoadReader(context.Background(), locationRows(2), &LoadOptions{Mode: ModeReplace})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Replace_Rename_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging (LIKE locations INCLUDING DEFAULTS, CONSTRAINT locations_staging_pkey PRIMARY KEY (id), " +
+		"CONSTRAINT uc_location_staging UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value))")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.expectCopyIgnore("locations_staging", 2, 2)
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_staging")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("ALTER TABLE locations RENAME TO locations_old")).
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := suite.driver.LoadReader(context.Background(), locationRows(2), &LoadOptions{Mode: ModeReplace})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Replace_Empty_Failure() {
+	require := suite.Require()
+	expectedError := "staging table has 0 rows, at least 1 required"
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE locations_staging (LIKE locations INCLUDING DEFAULTS, CONSTRAINT locations_staging_pkey PRIMARY KEY (id), " +
+		"CONSTRAINT uc_location_staging UNIQUE (ip_address,country_code,country,city,latitude,longitude,mystery_value))")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.expectCopyIgnore("locations_staging", 0, 0)
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_staging")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS locations_staging")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := suite.driver.LoadReader(context.Background(), locationRows(0), &LoadOptions{Mode: ModeReplace})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Upsert_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_upsert (ip_address VARCHAR(255) NOT NULL,")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.expectCopy("locations_upsert", 3)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations_upsert s USING locations_upsert t WHERE s.ip_address = t.ip_address AND s.source_row < t.source_row")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations l USING locations k, locations_upsert s")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE locations l SET")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) SELECT")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.driver.LoadReader(context.Background(), strings.NewReader(upsertRows), &LoadOptions{Mode: ModeUpsert})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2, Updated: 1}, result)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Delta_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_delta")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.expectCopy("locations_delta", 5)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations_delta s USING locations_delta t WHERE s.ip_address = t.ip_address AND s.source_row < t.source_row")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_delta s WHERE s.operation = 'delete'")).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations l USING locations_delta s WHERE l.ip_address = s.ip_address AND s.operation = 'delete'")).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations l USING locations k, locations_delta s")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE locations l SET")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations (ip_address,country_code,country,city,latitude,longitude,mystery_value) SELECT")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.driver.LoadReader(context.Background(), strings.NewReader(deltaRows), &LoadOptions{Mode: ModeDelta})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 1, Updated: 1, Deleted: 2}, result)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Delta_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_delta")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.expectCopy("locations_delta", 5)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM locations_delta s")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM locations_delta")).
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+
+	_, err := suite.driver.LoadReader(context.Background(), strings.NewReader(deltaRows), &LoadOptions{Mode: ModeDelta})
+	require.EqualError(err, expectedError)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_Checkpoint_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.expectCopyIgnore("locations", 3, 3)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO import_checkpoints (name, source_offset, line, rows_read, rows_loaded) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (name) DO UPDATE")).
+		WithArgs("data", 420, 6, 5, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+
+	checkpoint := &Checkpoint{Name: "data", Offset: 420, Line: 6, Rows: 5}
+	result, err := suite.driver.LoadReader(context.Background(), locationRows(3), &LoadOptions{Checkpoint: checkpoint})
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 3}, result)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Checkpoint_NotFound() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS import_checkpoints")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT source_offset, line, rows_read, rows_loaded FROM import_checkpoints WHERE name = $1")).
+		WithArgs("data").
+		WillReturnRows(sqlmock.NewRows([]string{"source_offset", "line", "rows_read", "rows_loaded"}))
+
+	checkpoint, err := suite.driver.Checkpoint(context.Background(), "data")
+	require.NoError(err)
+	require.Nil(checkpoint)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_LoadReader_Append_Success() {
+	require := suite.Require()
+
+	// One of the rows is a duplicate.
+	suite.sqlMock.ExpectBegin()
+	suite.expectCopyIgnore("locations", 3, 2)
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.driver.LoadReader(context.Background(), locationRows(3), nil)
+	require.NoError(err)
+	require.Equal(&LoadResult{Inserted: 2}, result)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_LoadReader_Append_DatabaseErr_Failure() {
+	require := suite.Require()
+	expectedError := "database error"
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_load")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.expectCopy("locations_load", 2)
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations")).
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+
+	_, err := suite.driver.LoadReader(context.Background(), locationRows(2), nil)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *PostgresTestSuite) TestPostgres_LoadReader_Null_Success() {
+	require := suite.Require()
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_delta")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	prepare := suite.sqlMock.ExpectPrepare(regexp.QuoteMeta(`COPY "locations_delta" (`))
+	prepare.ExpectExec().
+		WithArgs("127.0.0.4", nil, nil, nil, nil, nil, nil, "delete", "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	prepare.ExpectExec().
+		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
+
+	_, err := suite.driver.LoadReader(context.Background(), strings.NewReader("127.0.0.4,\\N,\\N,\\N,\\N,\\N,\\N,delete,1\n"), &LoadOptions{Mode: ModeDelta})
+	require.EqualError(err, "database error")
+}
+
+func (suite *PostgresTestSuite) TestPostgres_Load_OpenFile_Failure() {
+	require := suite.Require()
+	expectedError := "open data.csv: no such file or directory"
+
+	_, err := suite.driver.Load(context.Background(), "data.csv", nil)
+	require.EqualError(err, expectedError)
+}
+
+func TestPostgres(t *testing.T) {
+	suite.Run(t, new(PostgresTestSuite))
+}
@@ -0,0 +1,86 @@
+package geoolocation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// Dialect configures how the source is parsed. The fields have the same meaning as
+// in encoding/csv.Reader.
+type Dialect struct {
+	// The field delimiter, ',' by default and '\t' for .tsv files.
+	Comma rune
+
+	// Lines beginning with the Comment character are ignored, if it's not 0.
+	Comment rune
+
+	// A quote may appear in an unquoted field and a non-doubled quote may appear
+	// in a quoted field.
+	LazyQuotes bool
+
+	// The number of fields per record. If 0, it's set to the number of fields of
+	// the first record, and if negative, records may have a variable number of fields.
+	FieldsPerRecord int
+
+	// Leading white space in a field is ignored.
+	TrimLeadingSpace bool
+
+	// StripBOM removes a UTF-8 byte order mark from the start of the source, which
+	// otherwise makes the first header cell fail to match.
+	StripBOM bool
+}
+
+// newCSVReader returns a reader of source configured by the dialect. A nil dialect
+// uses the defaults of encoding/csv, except for the delimiter of .tsv files.
+func newCSVReader(source io.Reader, path string, d *Dialect) *csv.Reader {
+	if d == nil {
+		d = &Dialect{}
+	}
+
+	if d.StripBOM {
+		source = stripBOM(source)
+	}
+
+	reader := csv.NewReader(source)
+	reader.Comment = d.Comment
+	reader.LazyQuotes = d.LazyQuotes
+	reader.FieldsPerRecord = d.FieldsPerRecord
+	reader.TrimLeadingSpace = d.TrimLeadingSpace
+
+	switch {
+	case d.Comma != 0:
+		reader.Comma = d.Comma
+	case dataExt(path) == ".tsv":
+		reader.Comma = '\t'
+	}
+
+	return reader
+}
+
+// stripBOM skips a UTF-8 byte order mark at the start of r.
+func stripBOM(r io.Reader) io.Reader {
+	buffered := bufio.NewReader(r)
+	if head, err := buffered.Peek(len(utf8BOM)); err == nil && bytes.Equal(head, utf8BOM) {
+		_, _ = buffered.Discard(len(utf8BOM))
+	}
+
+	return buffered
+}
+
+// dataExt returns the lower case extension of path ignoring a compression extension,
+// e.g. ".csv" for "data.csv.gz".
+func dataExt(path string) string {
+	switch compressionByExt(path) {
+	case compressionGzip, compressionZstd:
+		path = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+
+	return strings.ToLower(filepath.Ext(path))
+}
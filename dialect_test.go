@@ -0,0 +1,86 @@
+package geoolocation
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"strings"
+	"testing"
+)
+
+type DialectTestSuite struct {
+	suite.Suite
+}
+
+func (suite *DialectTestSuite) readAll(data, path string, d *Dialect) ([][]string, error) {
+	return newCSVReader(strings.NewReader(data), path, d).ReadAll()
+}
+
+func (suite *DialectTestSuite) TestDialect_newCSVReader_Default() {
+	require := suite.Require()
+
+	records, err := suite.readAll("a,b\nc,d\n", "data.csv", nil)
+	require.NoError(err)
+	require.Equal([][]string{{"a", "b"}, {"c", "d"}}, records)
+}
+
+func (suite *DialectTestSuite) TestDialect_newCSVReader_TSV() {
+	require := suite.Require()
+
+	records, err := suite.readAll("a\tb\nc\td\n", "data.tsv.gz", nil)
+	require.NoError(err)
+	require.Equal([][]string{{"a", "b"}, {"c", "d"}}, records)
+}
+
+func (suite *DialectTestSuite) TestDialect_newCSVReader_Options() {
+	require := suite.Require()
+
+	records, err := suite.readAll("\xef\xbb\xbfa; b\"b\n# comment\nc;d;e\n", "", &Dialect{
+		Comma:            ';',
+		Comment:          '#',
+		LazyQuotes:       true,
+		FieldsPerRecord:  -1,
+		TrimLeadingSpace: true,
+		StripBOM:         true,
+	})
+	require.NoError(err)
+	require.Equal([][]string{{"a", "b\"b"}, {"c", "d", "e"}}, records)
+}
+
+func (suite *DialectTestSuite) TestDialect_newCSVReader_KeepBOM() {
+	require := suite.Require()
+
+	records, err := suite.readAll("\xef\xbb\xbfa,b\n", "", nil)
+	require.NoError(err)
+	require.Equal([][]string{{"\xef\xbb\xbfa", "b"}}, records)
+}
+
+func (suite *DialectTestSuite) TestDialect_ImportCSV_TSVWithBOM_Success() {
+	require := suite.Require()
+
+	data := "\xef\xbb\xbfip_address\tcountry_code\tcountry\tcity\tlatitude\tlongitude\tmystery_value\n" +
+		"127.0.0.1\tUS\ttest\ttest\t48.92021642445653\t14.900399560492929\t2147483647\n" +
+		"127.0.0.2\tGB\n"
+	err := os.WriteFile("data18.tsv", []byte(data), 0644)
+	require.NoError(err)
+
+	var rejected []RejectedRow
+	result, err := new(Geo).ImportCSVContext(context.Background(), "data18.tsv", &ImportOptions{
+		DryRun:  true,
+		Dialect: &Dialect{StripBOM: true, FieldsPerRecord: -1},
+		OnReject: func(row RejectedRow) {
+			rejected = append(rejected, row)
+		},
+	})
+	require.NoError(err)
+	require.Equal(int64(1), result.AcceptedRows)
+	require.Equal(int64(1), result.ParseErrors)
+	require.Equal([]RejectedRow{{Line: 3, Record: []string{"127.0.0.2", "GB"}, Reason: "missing fields"}}, rejected)
+
+	err = deleteCSV("data18.tsv")
+	require.NoError(err)
+}
+
+func TestDialect(t *testing.T) {
+	suite.Run(t, new(DialectTestSuite))
+}
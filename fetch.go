@@ -0,0 +1,322 @@
+package geoolocation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+// The defaults of FetchOptions.
+const (
+	defaultFetchInterval   = time.Hour
+	defaultFetchRetries    = 3
+	defaultFetchRetryDelay = time.Second
+)
+
+// FetchOptions configures FetchCSV and ScheduleFetch.
+type FetchOptions struct {
+	// The client sending the requests, http.DefaultClient by default.
+	Client *http.Client
+
+	// Header is added to every request, e.g. for authorization.
+	Header http.Header
+
+	// The validators of the last fetch, see FetchResult. The request is made
+	// conditional on them, and the import is skipped if the server reports the
+	// content unchanged, or it has the same SHA256.
+	ETag         string
+	LastModified string
+	SHA256       string
+
+	// The number of times a failed request is retried, 3 by default, or none if it's
+	// negative. Network errors, 429 and 5xx responses are retried, waiting RetryDelay,
+	// one second by default, before the first retry and twice as long before every
+	// next one.
+	Retries    int
+	RetryDelay time.Duration
+
+	// How often ScheduleFetch fetches, one hour by default.
+	Interval time.Duration
+
+	// Import configures the import of the fetched file. The file is downloaded to
+	// Import.TempDir first, so a checkpointed import needs a checkpoint name.
+	Import *ImportOptions
+
+	// OnResult, if not nil, is called by ScheduleFetch with the result of every fetch.
+	OnResult func(FetchResult)
+}
+
+// FetchResult is the outcome of a fetch.
+type FetchResult struct {
+	URL string `json:"url"`
+
+	// Changed reports whether the content changed since the last fetch and was
+	// imported.
+	Changed bool `json:"changed"`
+
+	// The validators to pass to the next fetch in FetchOptions.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+
+	// The result of the import, nil if the content didn't change or the fetch failed.
+	Result *Result `json:"result,omitempty"`
+
+	// Why the fetch failed, only set by ScheduleFetch.
+	Error string `json:"error,omitempty"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// statusError is returned when the server responds with an unexpected status.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.code, http.StatusText(e.code))
+}
+
+// download is a file downloaded by fetch.
+type download struct {
+	path         string
+	etag         string
+	lastModified string
+	sha256       string
+}
+
+// FetchCSV downloads the CSV at the url and imports it like ImportCSVContext, unless
+// it didn't change since the fetch with the validators of opts. The validators of
+// the result are those of the last fetch imported, so a failed import is tried again
+// by the next fetch.
+func (g *Geo) FetchCSV(ctx context.Context, rawURL string, opts *FetchOptions) (*FetchResult, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+
+	if opts.Import != nil && opts.Import.Checkpoint != nil && opts.Import.Checkpoint.Name == "" {
+		return nil, errors.New("checkpoint name is required when fetching")
+	}
+
+	result := &FetchResult{
+		URL:          rawURL,
+		ETag:         opts.ETag,
+		LastModified: opts.LastModified,
+		SHA256:       opts.SHA256,
+		Started:      time.Now(),
+	}
+
+	d, err := fetch(ctx, rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if d != nil {
+		defer os.Remove(d.path)
+
+		if d.sha256 != opts.SHA256 {
+			result.Result, err = g.ImportCSVContext(ctx, d.path, opts.Import)
+			if err != nil {
+				return nil, err
+			}
+			result.Changed = true
+		}
+
+		result.ETag, result.LastModified, result.SHA256 = d.etag, d.lastModified, d.sha256
+	}
+
+	result.Finished = time.Now()
+
+	return result, nil
+}
+
+// ScheduleFetch runs FetchCSV every Interval until ctx is done, passing the
+// validators of every fetch to the next one. A failed fetch is logged and reported
+// to OnResult, and tried again at the next interval. It returns the error of ctx.
+func (g *Geo) ScheduleFetch(ctx context.Context, rawURL string, opts *FetchOptions) error {
+	var o FetchOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	interval := o.Interval
+	if interval <= 0 {
+		interval = defaultFetchInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		started := time.Now()
+		result, err := g.FetchCSV(ctx, rawURL, &o)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			logrus.Errorf("error fetching %s: %v", rawURL, err)
+			result = &FetchResult{URL: rawURL, Error: err.Error(), Started: started, Finished: time.Now()}
+		} else {
+			o.ETag, o.LastModified, o.SHA256 = result.ETag, result.LastModified, result.SHA256
+			if result.Changed {
+				logrus.Infof("%s imported: %d rows accepted, %d discarded", rawURL, result.Result.AcceptedRows, result.Result.DiscardedRows)
+			}
+		}
+
+		if o.OnResult != nil {
+			o.OnResult(*result)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch downloads the url, retrying the failed requests. It returns nil if the
+// server reports the content unchanged.
+func fetch(ctx context.Context, rawURL string, opts *FetchOptions) (*download, error) {
+	retries := opts.Retries
+	if retries == 0 {
+		retries = defaultFetchRetries
+	}
+
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = defaultFetchRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		d, err := fetchOnce(ctx, rawURL, opts)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil || attempt >= retries || !retryable(err) {
+			return d, err
+		}
+
+		logrus.Warnf("error fetching %s, retrying in %s: %v", rawURL, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether the failed request may succeed if it's sent again: the
+// server answered 429 or 5xx, or the network failed. An invalid url, a canceled
+// request or a local file error fails the same way every time.
+func retryable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// The errors of the files wrap a syscall.Errno, which is a net.Error.
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+
+	// Every error of the client is a *url.Error, which is a net.Error itself.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// fetchOnce sends the conditional request and downloads the body to a temporary
+// file named like the url, so its extension is kept.
+func fetchOnce(ctx context.Context, rawURL string, opts *FetchOptions) (*download, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range opts.Header {
+		req.Header[key] = values
+	}
+	if opts.ETag != "" {
+		req.Header.Set("If-None-Match", opts.ETag)
+	}
+	if opts.LastModified != "" {
+		req.Header.Set("If-Modified-Since", opts.LastModified)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+
+	name := path.Base(u.Path)
+	if !validExtension(name) {
+		name = "fetched.csv"
+	}
+
+	var tempDir string
+	if opts.Import != nil {
+		tempDir = opts.Import.TempDir
+	}
+
+	file, err := os.CreateTemp(tempDir, "*-"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &download{
+		path:         file.Name(),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		sha256:       hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,250 @@
+package geoolocation
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const fetchTestData = "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+	"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+	"test,US,test,test,1,1,1\n"
+
+type FetchTestSuite struct {
+	suite.Suite
+	server   *httptest.Server
+	requests atomic.Int32
+
+	// The number of requests failed with 503 before the data is served.
+	failures int32
+
+	// The validators sent by the server, none if empty.
+	etag         string
+	lastModified string
+}
+
+func (suite *FetchTestSuite) SetupTest() {
+	suite.requests.Store(0)
+	suite.failures = 0
+	suite.etag = `"v1"`
+	suite.lastModified = ""
+
+	suite.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if suite.requests.Add(1) <= suite.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.URL.Path == "/missing.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if suite.etag != "" {
+			w.Header().Set("ETag", suite.etag)
+			if r.Header.Get("If-None-Match") == suite.etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		if suite.lastModified != "" {
+			w.Header().Set("Last-Modified", suite.lastModified)
+			if r.Header.Get("If-Modified-Since") == suite.lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		_, _ = w.Write([]byte(fetchTestData))
+	}))
+}
+
+func (suite *FetchTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *FetchTestSuite) options() *FetchOptions {
+	return &FetchOptions{
+		RetryDelay: time.Millisecond,
+		Import:     &ImportOptions{DryRun: true, TempDir: suite.T().TempDir()},
+	}
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_ETag_Success() {
+	require := suite.Require()
+
+	opts := suite.options()
+	result, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", opts)
+	require.NoError(err)
+	require.True(result.Changed)
+	require.Equal(`"v1"`, result.ETag)
+	require.NotEmpty(result.SHA256)
+	require.Equal(int64(1), result.Result.AcceptedRows)
+	require.Equal(map[string]int64{"invalid ip": 1}, result.Result.Rejected)
+
+	opts.ETag, opts.SHA256 = result.ETag, result.SHA256
+	result, err = new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", opts)
+	require.NoError(err)
+	require.False(result.Changed)
+	require.Nil(result.Result)
+	require.Equal(`"v1"`, result.ETag)
+	require.Equal(opts.SHA256, result.SHA256)
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_LastModified_Success() {
+	require := suite.Require()
+
+	suite.etag = ""
+	suite.lastModified = "Thu, 15 Oct 2026 07:00:00 GMT"
+
+	opts := suite.options()
+	result, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data", opts)
+	require.NoError(err)
+	require.True(result.Changed)
+	require.Equal(suite.lastModified, result.LastModified)
+
+	opts.LastModified = result.LastModified
+	result, err = new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data", opts)
+	require.NoError(err)
+	require.False(result.Changed)
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_SameContent_Success() {
+	require := suite.Require()
+
+	// Without validators, the content is compared by its hash.
+	suite.etag = ""
+
+	opts := suite.options()
+	result, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", opts)
+	require.NoError(err)
+	require.True(result.Changed)
+
+	opts.SHA256 = result.SHA256
+	result, err = new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", opts)
+	require.NoError(err)
+	require.False(result.Changed)
+	require.Nil(result.Result)
+	require.Equal(int32(2), suite.requests.Load())
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_Retry_Success() {
+	require := suite.Require()
+
+	suite.failures = 2
+
+	result, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", suite.options())
+	require.NoError(err)
+	require.True(result.Changed)
+	require.Equal(int32(3), suite.requests.Load())
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_Retry_Failure() {
+	require := suite.Require()
+
+	suite.failures = 10
+
+	opts := suite.options()
+	opts.Retries = 2
+	_, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", opts)
+	require.EqualError(err, "unexpected status 503 Service Unavailable")
+	require.Equal(int32(3), suite.requests.Load())
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_NotFound_Failure() {
+	require := suite.Require()
+
+	_, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/missing.csv", suite.options())
+	require.EqualError(err, "unexpected status 404 Not Found")
+	require.Equal(int32(1), suite.requests.Load())
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_TempDir_Failure() {
+	require := suite.Require()
+
+	// A local error isn't retried.
+	opts := suite.options()
+	opts.Import.TempDir = filepath.Join(opts.Import.TempDir, "missing")
+	_, err := new(Geo).FetchCSV(context.Background(), suite.server.URL+"/data.csv", opts)
+	require.ErrorIs(err, os.ErrNotExist)
+	require.Equal(int32(1), suite.requests.Load())
+}
+
+func (suite *FetchTestSuite) TestFetch_FetchCSV_Canceled_Failure() {
+	require := suite.Require()
+
+	suite.failures = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := suite.options()
+	opts.Client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		cancel()
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	_, err := new(Geo).FetchCSV(ctx, suite.server.URL+"/data.csv", opts)
+	require.Equal(context.Canceled, err)
+	require.LessOrEqual(suite.requests.Load(), int32(1))
+}
+
+func (suite *FetchTestSuite) TestFetch_retryable() {
+	require := suite.Require()
+
+	require.True(retryable(&statusError{code: http.StatusTooManyRequests}))
+	require.True(retryable(&statusError{code: http.StatusBadGateway}))
+	require.False(retryable(&statusError{code: http.StatusForbidden}))
+	require.True(retryable(&url.Error{Op: "Get", URL: "http://example.com", Err: io.EOF}))
+	require.True(retryable(&url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}))
+	require.True(retryable(io.ErrUnexpectedEOF))
+	require.False(retryable(&url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New("unsupported protocol scheme")}))
+	require.False(retryable(&url.Error{Op: "Get", URL: "http://example.com", Err: context.Canceled}))
+	require.False(retryable(&os.PathError{Op: "open", Path: "/tmp", Err: os.ErrPermission}))
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func (suite *FetchTestSuite) TestFetch_ScheduleFetch_Success() {
+	require := suite.Require()
+
+	results := make(chan FetchResult, 2)
+	opts := suite.options()
+	opts.Interval = 10 * time.Millisecond
+	opts.OnResult = func(result FetchResult) {
+		select {
+		case results <- result:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- new(Geo).ScheduleFetch(ctx, suite.server.URL+"/data.csv", opts)
+	}()
+
+	first, second := <-results, <-results
+	cancel()
+	require.ErrorIs(<-errs, context.Canceled)
+
+	require.True(first.Changed)
+	require.False(second.Changed)
+	require.Equal(first.ETag, second.ETag)
+}
+
+func TestFetch(t *testing.T) {
+	suite.Run(t, new(FetchTestSuite))
+}
@@ -0,0 +1,186 @@
+package geoolocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/zeynab-sb/geoolocation/database"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FilesResult is returned in ImportFiles.
+type FilesResult struct {
+	// The totals of all the files.
+	Result
+
+	// The result of every file, in the order they're imported.
+	Files []FileResult `json:"files"`
+}
+
+// FileResult is the result of one of the files imported by ImportFiles. When the
+// files are loaded in a single transaction, the rows loaded can't be told apart by
+// file, so only TotalRows, DiscardedRows, ParseErrors, Rejected and Flagged are
+// set, and DiscardedRows doesn't include the duplicates.
+type FileResult struct {
+	Path string `json:"path"`
+
+	Result
+}
+
+// ImportFiles imports several files as one run. Every pattern may be a file, a
+// directory, whose .csv, .tsv, .txt and compressed files are imported in name
+// order, or a glob such as data/*.csv.gz. A file matched more than once is
+// imported once.
+//
+// By default, the files are imported one after another, each of them like by
+// ImportCSVContext, so a failure leaves the files before it imported. With
+// opts.SingleTransaction or in database.ModeReplace, the rows of all the files are
+// loaded together instead. The rejected rows of every file are reported with its
+// path, see RejectedRow.
+func (g *Geo) ImportFiles(ctx context.Context, patterns []string, opts *ImportOptions) (*FilesResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	paths, err := resolvePaths(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	together := opts.SingleTransaction || opts.Mode == database.ModeReplace
+	if opts.Checkpoint != nil && !opts.DryRun {
+		if together {
+			return nil, errors.New("checkpoints are not supported in a single transaction")
+		}
+		if opts.Checkpoint.Name != "" && len(paths) > 1 {
+			return nil, errors.New("checkpoint name can't be shared by several files")
+		}
+	}
+
+	rejecter, err := newRejecter(opts.RejectWriter, opts.OnReject, rejectFields(opts), true)
+	if err != nil {
+		return nil, err
+	}
+	// The rows rejected before a failure are reported as well.
+	defer rejecter.flush()
+
+	if together {
+		result, files, err := g.run(ctx, "", nil, paths, rejecter, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// A single file is the whole run.
+		if files == nil {
+			files = []Result{*result}
+		}
+
+		filesResult := &FilesResult{Result: *result}
+		for j, path := range paths {
+			filesResult.Files = append(filesResult.Files, FileResult{Path: path, Result: files[j]})
+		}
+
+		return filesResult, nil
+	}
+
+	start := time.Now()
+
+	filesResult := &FilesResult{Result: Result{Rejected: make(map[string]int64)}}
+	for _, path := range paths {
+		result, _, err := g.run(ctx, path, nil, []string{path}, rejecter, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		filesResult.add(result)
+		filesResult.Files = append(filesResult.Files, FileResult{Path: path, Result: *result})
+	}
+
+	filesResult.TimeTaken = time.Since(start).Seconds()
+
+	return filesResult, nil
+}
+
+// add adds the rows of the result to the totals.
+func (r *FilesResult) add(result *Result) {
+	r.TotalRows += result.TotalRows
+	r.AcceptedRows += result.AcceptedRows
+	r.InsertedRows += result.InsertedRows
+	r.UpdatedRows += result.UpdatedRows
+	r.DeletedRows += result.DeletedRows
+	r.DiscardedRows += result.DiscardedRows
+	r.ParseErrors += result.ParseErrors
+	r.DuplicateRows += result.DuplicateRows
+	for reason, n := range result.Rejected {
+		r.Rejected[reason] += n
+	}
+	for rule, n := range result.Flagged {
+		if r.Flagged == nil {
+			r.Flagged = make(map[string]int64)
+		}
+		r.Flagged[rule] += n
+	}
+}
+
+// resolvePaths returns the files of the patterns, see ImportFiles.
+func resolvePaths(patterns []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() && validExtension(match) {
+					add(match)
+				}
+			}
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			if !validExtension(pattern) {
+				return nil, fmt.Errorf("%s: invalid file extension", pattern)
+			}
+			add(pattern)
+			continue
+		}
+
+		// The entries are sorted by name.
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && validExtension(entry.Name()) {
+				add(filepath.Join(pattern, entry.Name()))
+			}
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New("no files to import")
+	}
+
+	return paths, nil
+}
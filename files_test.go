@@ -0,0 +1,138 @@
+package geoolocation
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/suite"
+	"github.com/zeynab-sb/geoolocation/database"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type FilesTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *FilesTestSuite) SetupTest() {
+	require := suite.Require()
+
+	suite.dir = suite.T().TempDir()
+	header := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n"
+	row := "127.0.0.%d,US,test,test,48.92021642445653,14.900399560492929,2147483647\n"
+
+	files := map[string]string{
+		"a.csv":  header + strings.ReplaceAll(row, "%d", "1") + strings.ReplaceAll(row, "%d", "2"),
+		"b.csv":  header + strings.ReplaceAll(row, "%d", "3") + "test,US,test,test,1,1,1\n",
+		"c.tsv":  strings.ReplaceAll(header+strings.ReplaceAll(row, "%d", "4"), ",", "\t"),
+		"d.txt":  header + "127.0.0.5,US\n",
+		"e.json": "{}",
+	}
+	for name, data := range files {
+		require.NoError(os.WriteFile(filepath.Join(suite.dir, name), []byte(data), 0o644))
+	}
+	require.NoError(os.Mkdir(filepath.Join(suite.dir, "f.csv"), 0o755))
+}
+
+func (suite *FilesTestSuite) path(name string) string {
+	return filepath.Join(suite.dir, name)
+}
+
+func (suite *FilesTestSuite) TestFiles_resolvePaths() {
+	require := suite.Require()
+
+	paths, err := resolvePaths([]string{suite.dir})
+	require.NoError(err)
+	require.Equal([]string{suite.path("a.csv"), suite.path("b.csv"), suite.path("c.tsv"), suite.path("d.txt")}, paths)
+
+	paths, err = resolvePaths([]string{suite.path("b.csv"), filepath.Join(suite.dir, "*.csv")})
+	require.NoError(err)
+	require.Equal([]string{suite.path("b.csv"), suite.path("a.csv")}, paths)
+
+	_, err = resolvePaths([]string{suite.path("e.json")})
+	require.EqualError(err, suite.path("e.json")+": invalid file extension")
+
+	_, err = resolvePaths([]string{filepath.Join(suite.dir, "*.gz")})
+	require.EqualError(err, "no files to import")
+}
+
+func (suite *FilesTestSuite) TestFiles_ImportFiles_Success() {
+	require := suite.Require()
+
+	var rejected []RejectedRow
+	result, err := new(Geo).ImportFiles(context.Background(), []string{suite.dir}, &ImportOptions{
+		DryRun: true,
+		OnReject: func(row RejectedRow) {
+			rejected = append(rejected, row)
+		},
+	})
+	require.NoError(err)
+	require.Equal(int64(6), result.TotalRows)
+	require.Equal(int64(4), result.AcceptedRows)
+	require.Equal(int64(2), result.DiscardedRows)
+	require.Equal(int64(1), result.ParseErrors)
+	require.Equal(map[string]int64{"invalid ip": 1}, result.Rejected)
+
+	require.Len(result.Files, 4)
+	require.Equal(suite.path("b.csv"), result.Files[1].Path)
+	require.Equal(int64(2), result.Files[1].TotalRows)
+	require.Equal(int64(1), result.Files[1].AcceptedRows)
+	require.Equal(map[string]int64{"invalid ip": 1}, result.Files[1].Rejected)
+	require.Equal(int64(1), result.Files[2].AcceptedRows)
+	require.Equal(int64(1), result.Files[3].ParseErrors)
+
+	require.Equal([]RejectedRow{
+		{Line: 3, Record: []string{"test", "US", "test", "test", "1", "1", "1"}, Reason: "invalid ip", File: suite.path("b.csv")},
+		{Line: 2, Record: []string{"127.0.0.5", "US"}, Reason: "wrong number of fields", File: suite.path("d.txt")},
+	}, rejected)
+}
+
+func (suite *FilesTestSuite) TestFiles_ImportFiles_SingleTransaction_Success() {
+	require := suite.Require()
+
+	var rejects bytes.Buffer
+	result, err := new(Geo).ImportFiles(context.Background(), []string{filepath.Join(suite.dir, "*.csv"), suite.path("d.txt")}, &ImportOptions{
+		DryRun:            true,
+		Concurrency:       2,
+		SingleTransaction: true,
+		RejectWriter:      &rejects,
+	})
+	require.NoError(err)
+	require.Equal(int64(5), result.TotalRows)
+	require.Equal(int64(3), result.AcceptedRows)
+	require.Equal(int64(1), result.ParseErrors)
+
+	require.Equal([]FileResult{
+		{Path: suite.path("a.csv"), Result: Result{TotalRows: 2, Rejected: map[string]int64{}}},
+		{Path: suite.path("b.csv"), Result: Result{TotalRows: 2, DiscardedRows: 1, Rejected: map[string]int64{"invalid ip": 1}}},
+		{Path: suite.path("d.txt"), Result: Result{TotalRows: 1, DiscardedRows: 1, ParseErrors: 1, Rejected: map[string]int64{}}},
+	}, result.Files)
+
+	// The rows are rejected by the reader and the sanitizers in no particular order.
+	require.ElementsMatch([]string{
+		"ip_address,country_code,country,city,latitude,longitude,mystery_value,file,line,reason",
+		"test,US,test,test,1,1,1," + suite.path("b.csv") + ",3,invalid ip",
+		"127.0.0.5,US," + suite.path("d.txt") + ",2,wrong number of fields",
+	}, strings.Split(strings.TrimSpace(rejects.String()), "\n"))
+}
+
+func (suite *FilesTestSuite) TestFiles_ImportFiles_Checkpoint_Failure() {
+	require := suite.Require()
+
+	_, err := new(Geo).ImportFiles(context.Background(), []string{suite.dir}, &ImportOptions{
+		Mode:       database.ModeReplace,
+		Checkpoint: &CheckpointOptions{},
+	})
+	require.EqualError(err, "checkpoints are not supported in a single transaction")
+
+	_, err = new(Geo).ImportFiles(context.Background(), []string{suite.dir}, &ImportOptions{
+		Checkpoint: &CheckpointOptions{Name: "locations"},
+	})
+	require.EqualError(err, "checkpoint name can't be shared by several files")
+}
+
+func TestFiles(t *testing.T) {
+	suite.Run(t, new(FilesTestSuite))
+}
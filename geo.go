@@ -1,11 +1,13 @@
 package geoolocation
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/zeynab-sb/geoolocation/database"
 	"github.com/zeynab-sb/geoolocation/repository"
-	"path/filepath"
+	"io"
+	"os"
 	"time"
 )
 
@@ -27,7 +29,7 @@ func New(config *database.DBConfig) (*Geo, error) {
 		return nil, err
 	}
 
-	driver, err := database.New(config.Driver, db)
+	driver, err := config.NewDriver(db)
 	if err != nil {
 		return nil, err
 	}
@@ -39,14 +41,134 @@ func New(config *database.DBConfig) (*Geo, error) {
 
 // Result is returned in ImportCSV
 type Result struct {
-	// The number of rows in the correct format and inserted in DB.
-	acceptedRows int64
+	// The number of rows read from the source, excluding the header.
+	TotalRows int64 `json:"total_rows"`
 
-	// The number of corrupted rows.
-	discardedRows int64
+	// The number of rows in the correct format and inserted or updated in DB. In
+	// database.ModeDelta, the deleted rows are included too.
+	AcceptedRows int64 `json:"accepted_rows"`
+
+	// The number of rows inserted, included in AcceptedRows.
+	InsertedRows int64 `json:"inserted_rows"`
+
+	// The number of rows updated in place by database.ModeUpsert or
+	// database.ModeDelta, included in AcceptedRows.
+	UpdatedRows int64 `json:"updated_rows"`
+
+	// The number of stale rows deleted by database.ModeUpsert, or the number of
+	// ips deleted by database.ModeDelta.
+	DeletedRows int64 `json:"deleted_rows"`
+
+	// The number of rows that are not inserted for any reason.
+	DiscardedRows int64 `json:"discarded_rows"`
+
+	// The number of rows that can't be parsed as CSV, e.g. with a wrong number of fields.
+	ParseErrors int64 `json:"parse_errors"`
+
+	// The number of rows rejected by sanitizing, by reason, e.g. "invalid ip".
+	Rejected map[string]int64 `json:"rejected"`
+
+	// The number of rows flagged by the rules and loaded nonetheless, by rule, nil
+	// if no row is flagged. See Flag.
+	Flagged map[string]int64 `json:"flagged,omitempty"`
+
+	// The number of valid rows the database dropped as duplicates. In
+	// database.ModeUpsert, the rows that are already stored unchanged, and in
+	// database.ModeDelta the operations that change nothing, e.g. adding an ip
+	// that is stored or deleting one that isn't.
+	DuplicateRows int64 `json:"duplicate_rows"`
 
 	// The whole amount of time that it took to import CSV in seconds
-	timeTaken float64
+	TimeTaken float64 `json:"time_taken"`
+}
+
+// ImportOptions configures an import.
+type ImportOptions struct {
+	// The number of concurrent sanitizer processes. If you have just one
+	// hardware thread, don't set it more than one because the sanitizing
+	// is CPU bound, and it just increases the result time.
+	Concurrency uint
+
+	// The number of goroutines parsing the source. An uncompressed file of at least
+	// 64 MiB is split into ReadConcurrency ranges aligned on record boundaries, which
+	// are parsed concurrently. The rows reach the sanitizers, and the rejected rows
+	// are reported, in no particular order, but with their lines in the file. Other
+	// sources, checkpointed imports, and upserts and deltas, whose last row of an ip
+	// wins, are parsed by one goroutine, as they are by default.
+	ReadConcurrency uint
+
+	// RejectWriter, if not nil, receives every rejected row as CSV: the original
+	// fields followed by the line number in the source and the reason.
+	RejectWriter io.Writer
+
+	// OnReject, if not nil, is called with every rejected row. It is never called
+	// concurrently.
+	OnReject func(RejectedRow)
+
+	// OnFlag, if not nil, is called with every row flagged by a rule, once per rule.
+	// It is never called concurrently.
+	OnFlag func(FlaggedRow)
+
+	// OnProgress, if not nil, is called every ProgressInterval and whenever the
+	// phase changes. It is never called concurrently.
+	OnProgress func(Progress)
+
+	// How often OnProgress is called, one second by default.
+	ProgressInterval time.Duration
+
+	// DryRun checks the header and sanitizes every row without loading anything
+	// to the database, and returns the same Result and rejected rows. It doesn't
+	// need a database connection, so a zero Geo can be used, e.g. in CI:
+	//	new(geoolocation.Geo).ImportCSVContext(ctx, path, &ImportOptions{DryRun: true})
+	DryRun bool
+
+	// Columns maps the columns of the source to the location fields by name or
+	// index. Without it, the header must be exactly the default header.
+	Columns *ColumnMapping
+
+	// Dialect configures the delimiter, quoting and BOM handling of the source.
+	Dialect *Dialect
+
+	// Rules validate the rows in order, DefaultRules if it's nil. AddRules are run
+	// after them, except a rule named like one of them, which replaces it in place,
+	// e.g. to accept a float mystery value it truncates to an integer, as the
+	// fields must stay loadable into locations. The rules named in DisableRules are
+	// skipped. The delete rows of a delta are only validated by the rule named
+	// RuleIP. See Rule.
+	Rules        []Rule
+	AddRules     []Rule
+	DisableRules []string
+
+	// Mode selects how the rows are applied to the locations table. By default
+	// they are appended, database.ModeReplace refreshes the whole table atomically
+	// through a staging table, database.ModeUpsert updates the locations in
+	// place keyed on the ip address, and database.ModeDelta applies the add,
+	// update and delete operations of a delta file in one transaction. A delta
+	// file has an operation column after the default header. If an ip appears
+	// more than once in an upsert or a delta, its last row wins.
+	Mode database.Mode
+
+	// The least number of rows the staging table must have to replace the
+	// locations table in database.ModeReplace. At least one row is always required.
+	MinRows int64
+
+	// Checkpoint, if not nil, makes the import resumable, see CheckpointOptions.
+	// It's ignored in a dry run.
+	Checkpoint *CheckpointOptions
+
+	// Stream streams the sanitized rows to the database while they're sanitized,
+	// without an intermediate file. By default they're written to a temporary file
+	// and loaded once they're all sanitized. Checkpointed imports are never streamed.
+	Stream bool
+
+	// The directory of the sanitized file, the default directory for temporary files
+	// if it's empty.
+	TempDir string
+
+	// SingleTransaction makes Geo.ImportFiles load the rows of all the files
+	// together, in one transaction, instead of one file after another. It's
+	// implied by database.ModeReplace, and not supported with checkpoints.
+	SingleTransaction bool
 }
 
 // ImportCSV function, give path and the number of concurrent  processes.
@@ -54,52 +176,217 @@ type Result struct {
 // one because the process that is in the concurrent part is CPU bound,
 // and it just increases the result time.
 func (g *Geo) ImportCSV(path string, concurrency uint) (*Result, error) {
-	if filepath.Ext(path) != ".csv" {
+	return g.ImportCSVContext(context.Background(), path, &ImportOptions{Concurrency: concurrency})
+}
+
+// ImportCSVContext is like ImportCSV but stops reading, drains the sanitizers,
+// removes a spooled sanitized file and cancels the running load when ctx is done. The
+// file may be a .csv, .tsv or .txt file, compressed as .gz or .zst, or be a
+// single-file .zip archive.
+func (g *Geo) ImportCSVContext(ctx context.Context, path string, opts *ImportOptions) (*Result, error) {
+	if !validExtension(path) {
 		return nil, errors.New("invalid file extension")
 	}
 
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return g.importCSV(ctx, path, file, opts)
+}
+
+// validExtension reports whether path is a .csv, .tsv or .txt file, optionally
+// compressed as .gz or .zst, or a .zip archive.
+func validExtension(path string) bool {
+	if compressionByExt(path) == compressionZip {
+		return true
+	}
+
+	switch dataExt(path) {
+	case ".csv", ".tsv", ".txt":
+		return true
+	}
+
+	return false
+}
+
+// ImportReader runs the same sanitize-and-load pipeline as ImportCSVContext on
+// any CSV stream, e.g. an HTTP body or stdin. Gzip, zstd and zip streams are
+// detected by their magic bytes and decompressed on the fly.
+func (g *Geo) ImportReader(ctx context.Context, r io.Reader, opts *ImportOptions) (*Result, error) {
+	return g.importCSV(ctx, "", r, opts)
+}
+
+// importCSV imports the CSV read from source. The path is only used to name the
+// sanitized file and is empty when importing from a reader.
+func (g *Geo) importCSV(ctx context.Context, path string, source io.Reader, opts *ImportOptions) (*Result, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	rejecter, err := newRejecter(opts.RejectWriter, opts.OnReject, rejectFields(opts), false)
+	if err != nil {
+		return nil, err
+	}
+	// The rows rejected before a failure are reported as well.
+	defer rejecter.flush()
+
+	result, _, err := g.run(ctx, path, source, nil, rejecter, opts)
+
+	return result, err
+}
+
+// rejectFields returns the fields of the rows reported as rejected.
+func rejectFields(opts *ImportOptions) []string {
+	if opts.Mode == database.ModeDelta {
+		return deltaHeader
+	}
+
+	return csvHeader
+}
+
+// run runs the sanitize-and-load pipeline on the source, or if paths isn't nil, on
+// the files one after another. With several paths, it returns the rows read and
+// rejected of each file too, see FileResult.
+func (g *Geo) run(ctx context.Context, path string, source io.Reader, paths []string, rejecter *rejecter, opts *ImportOptions) (*Result, []Result, error) {
 	// If concurrency sent 0 it will set to because we need at least one
 	//go routine to sanitize.
+	concurrency := opts.Concurrency
 	if concurrency == 0 {
 		concurrency = 1
 	}
 
 	start := time.Now()
 
+	counter := &countingReader{r: source}
+
 	data := make(chan csvData, concurrency)
 	signal := make(chan bool)
 	importer := csvImporter{
-		path:        path,
-		concurrency: int(concurrency),
-		driver:      g.driver,
-		db:          g.db,
-		data:        data,
-		signal:      signal,
+		path:            path,
+		source:          counter,
+		paths:           paths,
+		counter:         counter,
+		concurrency:     int(concurrency),
+		readConcurrency: int(opts.ReadConcurrency),
+		driver:          g.driver,
+		db:              g.db,
+		data:            data,
+		signal:          signal,
+		rejecter:        rejecter,
+		onFlag:          opts.OnFlag,
+		dryRun:          opts.DryRun,
+		columns:         opts.Columns,
+		dialect:         opts.Dialect,
+		loadOptions:     &database.LoadOptions{Mode: opts.Mode, MinRows: opts.MinRows},
+		spool:           !opts.Stream || opts.Checkpoint != nil,
+		tempDir:         opts.TempDir,
+	}
+	if len(paths) > 1 {
+		importer.files = make([]importStats, len(paths))
 	}
 
-	if err := importer.setUpSanitizer(); err != nil {
-		return nil, err
+	var err error
+	importer.rules, err = resolveRules(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	totalBytes := sourceSize(source)
+	if paths != nil {
+		totalBytes = filesSize(paths)
+	}
+	importer.progress = newProgressReporter(opts.OnProgress, opts.ProgressInterval, &importer.stats, counter, totalBytes)
+
+	if opts.Checkpoint != nil && !opts.DryRun {
+		if opts.Mode != database.ModeAppend {
+			return nil, nil, errors.New("checkpoints are only supported in append mode")
+		}
+
+		name, err := checkpointName(path, opts.Checkpoint)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		importer.checkpoint, err = resumeCheckpoint(ctx, g.driver, name, opts.Checkpoint.Resume)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		importer.checkpointRows = opts.Checkpoint.Rows
+		if importer.checkpointRows <= 0 {
+			importer.checkpointRows = defaultCheckpointRows
+		}
 	}
 
-	totalRows, err := importer.read()
+	// A failed streaming load stops the read and the sanitizers.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	importer.cancel = cancel
+
+	if err := importer.setUpSanitizer(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer importer.clean()
+
+	importer.progress.start()
+	defer importer.progress.stop()
+
+	totalRows, err := importer.read(ctx)
 	if err != nil {
-		return nil, err
+		// The sanitizers stop once the data channel is closed, wait for
+		// them so nothing is left writing to the sanitized file.
+		importer.abort(err)
+		if errors.Is(err, context.Canceled) {
+			err = context.Cause(ctx)
+		}
+		return nil, nil, err
 	}
 
-	insertedRows, err := importer.load()
+	loaded, err := importer.load(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	acceptedRows := loaded.Inserted + loaded.Updated
+	if opts.Mode == database.ModeDelta {
+		acceptedRows += loaded.Deleted
 	}
 
-	importer.clean()
+	if err := rejecter.flush(); err != nil {
+		return nil, nil, err
+	}
+
+	importer.progress.setPhase(PhaseDone)
 
 	finished := time.Now()
 
+	var files []Result
+	for j := range importer.files {
+		stats := &importer.files[j]
+		files = append(files, Result{
+			TotalRows:     stats.read.Load(),
+			DiscardedRows: stats.parseErrors.Load() + stats.rejectedRows.Load(),
+			ParseErrors:   stats.parseErrors.Load(),
+			Rejected:      stats.rejectedByReason(),
+			Flagged:       stats.flaggedByRule(),
+		})
+	}
+
 	return &Result{
-		acceptedRows:  insertedRows,
-		discardedRows: totalRows - insertedRows,
-		timeTaken:     finished.Sub(start).Seconds(),
-	}, nil
+		TotalRows:     totalRows,
+		AcceptedRows:  acceptedRows,
+		InsertedRows:  loaded.Inserted,
+		UpdatedRows:   loaded.Updated,
+		DeletedRows:   loaded.Deleted,
+		DiscardedRows: totalRows - acceptedRows,
+		ParseErrors:   importer.stats.parseErrors.Load(),
+		Rejected:      importer.stats.rejectedByReason(),
+		Flagged:       importer.stats.flaggedByRule(),
+		DuplicateRows: importer.stats.sanitized.Load() - acceptedRows,
+		TimeTaken:     finished.Sub(start).Seconds(),
+	}, files, nil
 }
 
 // CreateSchema create locations table based on the driver
@@ -1,7 +1,10 @@
 package geoolocation
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/agiledragon/gomonkey/v2"
@@ -10,7 +13,11 @@ import (
 	"github.com/zeynab-sb/geoolocation/database"
 	"log"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 type GeoTestSuite struct {
@@ -55,18 +62,28 @@ func (suite *GeoTestSuite) TestGeo_ImportCSV_InvalidExtension_Failure() {
 	require := suite.Require()
 	expectedError := "invalid file extension"
 
-	_, err := suite.geo.ImportCSV("data.txt", 1)
+	_, err := suite.geo.ImportCSV("data.json", 1)
 	require.EqualError(err, expectedError)
 }
 
-func (suite *GeoTestSuite) TestGeo_ImportCSV_SetupSanitizer_Failure() {
+func (suite *GeoTestSuite) TestGeo_ImportCSV_OpenFile_Failure() {
+	require := suite.Require()
+	expectedError := "error opening file"
+
+	suite.patch.ApplyFuncReturn(os.OpenFile, nil, errors.New("error opening file"))
+
+	_, err := suite.geo.ImportCSV("data.csv", 1)
+	require.EqualError(err, expectedError)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_SetupSanitizer_Failure() {
 	require := suite.Require()
 	expectedError := "error creating file"
 
 	// setupSanitizer will return error while creating file
 	suite.patch.ApplyFuncReturn(os.OpenFile, nil, errors.New("error creating file"))
 
-	_, err := suite.geo.ImportCSV("data.csv", 1)
+	_, err := suite.geo.ImportReader(context.Background(), strings.NewReader(""), nil)
 	require.EqualError(err, expectedError)
 }
 
@@ -87,8 +104,8 @@ func (suite *GeoTestSuite) TestGeo_ImportCSV_read_Failure() {
 	err = deleteCSV("data9.csv")
 	require.NoError(err)
 
-	err = deleteCSV("../data9_sanitized.csv")
-	require.NoError(err)
+	_, err = os.Stat("../data9_sanitized.csv")
+	require.True(os.IsNotExist(err))
 }
 
 func (suite *GeoTestSuite) TestGeo_ImportCSV_load_Failure() {
@@ -97,14 +114,16 @@ func (suite *GeoTestSuite) TestGeo_ImportCSV_load_Failure() {
 
 	err := createCSV([][]string{
 		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
-		{"127.0.0.1", "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
-		{"127.0.0.2", "TB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"}},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"}},
 		"data10.csv")
 	require.NoError(err)
 
 	// load will return error by database
-	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '../data10_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
 		WillReturnError(errors.New("database error"))
+	suite.sqlMock.ExpectRollback()
 
 	_, err = suite.geo.ImportCSV("data10.csv", 1)
 	require.EqualError(err, expectedError)
@@ -112,8 +131,8 @@ func (suite *GeoTestSuite) TestGeo_ImportCSV_load_Failure() {
 	err = deleteCSV("data10.csv")
 	require.NoError(err)
 
-	err = deleteCSV("../data10_sanitized.csv")
-	require.NoError(err)
+	_, err = os.Stat("../data10_sanitized.csv")
+	require.True(os.IsNotExist(err))
 }
 
 func (suite *GeoTestSuite) TestGeo_ImportCSV_Success() {
@@ -123,24 +142,433 @@ func (suite *GeoTestSuite) TestGeo_ImportCSV_Success() {
 
 	err := createCSV([][]string{
 		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
-		{"127.0.0.1", "TA", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
-		{"127.0.0.2", "TB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
 		{"test", "test", "test", "test", "test", "test", "test"}},
 		"data11.csv")
 	require.NoError(err)
 
-	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '../data11_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
 		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectCommit()
 
 	result, err := suite.geo.ImportCSV("data11.csv", 1)
 	require.NoError(err)
-	require.Equal(acceptedRows, result.acceptedRows)
-	require.Equal(discardedRows, result.discardedRows)
+	require.Equal(acceptedRows, result.AcceptedRows)
+	require.Equal(discardedRows, result.DiscardedRows)
 
 	err = deleteCSV("data11.csv")
 	require.NoError(err)
 }
 
+func (suite *GeoTestSuite) TestGeo_ImportCSVContext_Canceled_Failure() {
+	require := suite.Require()
+
+	err := createCSV([][]string{
+		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"}},
+		"data12.csv")
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = suite.geo.ImportCSVContext(ctx, "data12.csv", &ImportOptions{Concurrency: 2})
+	require.ErrorIs(err, context.Canceled)
+
+	_, err = os.Stat("../data12_sanitized.csv")
+	require.True(os.IsNotExist(err))
+
+	err = deleteCSV("data12.csv")
+	require.NoError(err)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_Success() {
+	require := suite.Require()
+	acceptedRows := int64(1)
+	discardedRows := int64(1)
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"test,test,test,test,test,test,test\n"
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.geo.ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{Concurrency: 2})
+	require.NoError(err)
+	require.Equal(acceptedRows, result.AcceptedRows)
+	require.Equal(discardedRows, result.DiscardedRows)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_QuotedCountry_Success() {
+	require := suite.Require()
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"1.2.3.4,KR,Korea,Seoul,37.5,127,1\n"
+
+	// The sanitized file is read when it's loaded, it's removed afterwards.
+	var loaded []byte
+	loadQuery := regexp.MustCompile("^LOAD DATA LOCAL INFILE '(.+)' IGNORE")
+	matcher := sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+		if match := loadQuery.FindStringSubmatch(actualSQL); match != nil {
+			var err error
+			if loaded, err = os.ReadFile(match[1]); err != nil {
+				return err
+			}
+		}
+
+		return sqlmock.QueryMatcherRegexp.Match(expectedSQL, actualSQL)
+	})
+	mockDB, sqlMock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	require.NoError(err)
+	defer mockDB.Close()
+
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`IGNORE INTO TABLE locations FIELDS TERMINATED BY "," OPTIONALLY ENCLOSED BY '"' LINES TERMINATED BY "\n"`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	sqlMock.ExpectCommit()
+
+	geo := &Geo{db: mockDB, driver: &database.MySQLDriver{DB: mockDB}}
+	result, err := geo.ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		AddRules: []Rule{CountryNameRule(CountryNameRewrite, nil)},
+	})
+	require.NoError(err)
+	require.Equal(int64(1), result.AcceptedRows)
+	require.Equal("1.2.3.4,KR,\"Korea, Republic of\",Seoul,37.5,127,1\n", string(loaded))
+	require.NoError(sqlMock.ExpectationsWereMet())
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_Stream_Success() {
+	require := suite.Require()
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"test,test,test,test,test,test,test\n"
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE 'Reader::geoolocation_(.+)' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.geo.ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{Concurrency: 2, Stream: true})
+	require.NoError(err)
+	require.Equal(int64(1), result.AcceptedRows)
+	require.Equal(int64(1), result.DiscardedRows)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportCSV_Gzip_Success() {
+	require := suite.Require()
+	acceptedRows := int64(1)
+	discardedRows := int64(1)
+
+	err := os.WriteFile("data15.csv.gz", gzipBytes(compressTestCSV), 0644)
+	require.NoError(err)
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.geo.ImportCSV("data15.csv.gz", 1)
+	require.NoError(err)
+	require.Equal(acceptedRows, result.AcceptedRows)
+	require.Equal(discardedRows, result.DiscardedRows)
+
+	err = deleteCSV("data15.csv.gz")
+	require.NoError(err)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_RejectedRows_Success() {
+	require := suite.Require()
+	expectedRows := []RejectedRow{
+		{Line: 3, Record: []string{"127.0.0", "US", "te'st", "test", "48.92021642445653", "14.900399560492929", "2147483647"}, Reason: "invalid ip"},
+		{Line: 4, Record: []string{"test", "test"}, Reason: "wrong number of fields"},
+	}
+	expectedReport := "ip_address,country_code,country,city,latitude,longitude,mystery_value,line,reason\n" +
+		"127.0.0,US,te'st,test,48.92021642445653,14.900399560492929,2147483647,3,invalid ip\n" +
+		"test,test,4,wrong number of fields\n"
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"127.0.0,US,te'st,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"test,test\n"
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	suite.sqlMock.ExpectCommit()
+
+	var report bytes.Buffer
+	var rows []RejectedRow
+	_, err := suite.geo.ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		RejectWriter: &report,
+		OnReject: func(row RejectedRow) {
+			rows = append(rows, row)
+		},
+	})
+	require.NoError(err)
+
+	// The reader and the sanitizers reject rows concurrently.
+	sort.Slice(rows, func(a, b int) bool { return rows[a].Line < rows[b].Line })
+	require.Equal(expectedRows, rows)
+
+	lines := strings.SplitAfter(report.String(), "\n")
+	sort.Strings(lines[1:])
+	require.Equal(expectedReport, strings.Join(lines, ""))
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_ResultBreakdown_Success() {
+	require := suite.Require()
+	expectedResult := &Result{
+		TotalRows:     5,
+		AcceptedRows:  1,
+		InsertedRows:  1,
+		DiscardedRows: 4,
+		ParseErrors:   1,
+		Rejected:      map[string]int64{"invalid ip": 1, "invalid latitude": 1},
+		DuplicateRows: 1,
+	}
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"127.0.0,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"127.0.0.3,US,test,test,148.92021642445653,14.900399560492929,2147483647\n" +
+		"test,test\n"
+
+	// The second row is dropped by the database as a duplicate.
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	suite.sqlMock.ExpectCommit()
+
+	result, err := suite.geo.ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{Concurrency: 2})
+	require.NoError(err)
+
+	expectedResult.TimeTaken = result.TimeTaken
+	require.Equal(expectedResult, result)
+
+	encoded, err := json.Marshal(result)
+	require.NoError(err)
+	require.Contains(string(encoded), `"accepted_rows":1,`)
+	require.Contains(string(encoded), `"rejected":{"invalid ip":1,"invalid latitude":1}`)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_Delta_Success() {
+	require := suite.Require()
+	expectedResult := &Result{
+		TotalRows:     5,
+		AcceptedRows:  3,
+		InsertedRows:  1,
+		UpdatedRows:   1,
+		DeletedRows:   1,
+		DiscardedRows: 2,
+		Rejected:      map[string]int64{"invalid operation": 1},
+		DuplicateRows: 1,
+	}
+	expectedRows := []RejectedRow{
+		{Line: 6, Record: []string{"127.0.0.5", "US", "test", "test", "1", "2", "3", "replace"}, Reason: "invalid operation"},
+	}
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value,operation\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647,add\n" +
+		"127.0.0.2,US,test,test,48.92021642445653,14.900399560492929,2147483647, Update\n" +
+		"127.0.0.3,,,,,,,delete\n" +
+		"127.0.0.4,,,,,,,DELETE\n" +
+		"127.0.0.5,US,test,test,1,2,3,replace\n"
+
+	// The last delete is of an ip that isn't stored.
+	suite.sqlMock.ExpectExec("CREATE TABLE locations_delta_[0-9a-f]{16}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations_delta_[0-9a-f]{16} (.+),operation,source_row\\);").
+		WillReturnResult(sqlmock.NewResult(4, 4))
+	suite.sqlMock.ExpectExec("DELETE s FROM locations_delta_[0-9a-f]{16} s").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM locations_delta_[0-9a-f]{16} s WHERE s.operation = 'delete'").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE l FROM locations l JOIN locations_delta_")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("DELETE l FROM locations l JOIN locations k")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE locations l JOIN locations_delta_")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	suite.sqlMock.ExpectCommit()
+	suite.sqlMock.ExpectExec("DROP TABLE IF EXISTS locations_delta_[0-9a-f]{16}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var rows []RejectedRow
+	result, err := suite.geo.ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		Concurrency: 2,
+		Mode:        database.ModeDelta,
+		OnReject:    func(row RejectedRow) { rows = append(rows, row) },
+	})
+	require.NoError(err)
+
+	expectedResult.TimeTaken = result.TimeTaken
+	require.Equal(expectedResult, result)
+	require.Equal(expectedRows, rows)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_Postgres_Duplicates_Success() {
+	require := suite.Require()
+	expectedResult := &Result{
+		TotalRows:     3,
+		AcceptedRows:  2,
+		InsertedRows:  2,
+		DiscardedRows: 1,
+		Rejected:      map[string]int64{},
+		DuplicateRows: 1,
+	}
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n" +
+		"127.0.0.2,US,test,test,48.92021642445653,14.900399560492929,2147483647\n"
+
+	mockDB, sqlMock, err := sqlmock.New()
+	require.NoError(err)
+	defer mockDB.Close()
+
+	// The rows are streamed to the temporary table, and the duplicate is skipped by
+	// the insert.
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE locations_load")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	prepare := sqlMock.ExpectPrepare(regexp.QuoteMeta(`COPY "locations_load"`))
+	for j := 0; j < 3; j++ {
+		prepare.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	prepare.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 3))
+	sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO locations")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	sqlMock.ExpectCommit()
+
+	geo := Geo{db: mockDB, driver: &database.PostgresDriver{DB: mockDB}}
+	result, err := geo.ImportReader(context.Background(), strings.NewReader(data), nil)
+	require.NoError(err)
+	require.NoError(sqlMock.ExpectationsWereMet())
+
+	expectedResult.TimeTaken = result.TimeTaken
+	require.Equal(expectedResult, result)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportCSV_Progress_Success() {
+	require := suite.Require()
+	expectedPhases := []Phase{PhaseRead, PhaseSanitize, PhaseLoad, PhaseDone}
+
+	err := createCSV([][]string{
+		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"test", "test", "test", "test", "test", "test", "test"}},
+		"data16.csv")
+	require.NoError(err)
+
+	info, err := os.Stat("data16.csv")
+	require.NoError(err)
+
+	suite.sqlMock.ExpectBegin()
+	suite.sqlMock.ExpectExec("LOAD DATA LOCAL INFILE '(.+)_sanitized.csv' IGNORE INTO TABLE locations (.+)").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	suite.sqlMock.ExpectCommit()
+
+	var reports []Progress
+	_, err = suite.geo.ImportCSVContext(context.Background(), "data16.csv", &ImportOptions{
+		OnProgress: func(p Progress) {
+			reports = append(reports, p)
+		},
+		ProgressInterval: time.Hour,
+	})
+	require.NoError(err)
+
+	var phases []Phase
+	for _, p := range reports {
+		phases = append(phases, p.Phase)
+	}
+	require.Equal(expectedPhases, phases)
+
+	require.Equal(Progress{
+		Phase:         PhaseDone,
+		RowsRead:      3,
+		RowsSanitized: 2,
+		RowsRejected:  1,
+		BytesRead:     info.Size(),
+		TotalBytes:    info.Size(),
+	}, reports[len(reports)-1])
+
+	err = deleteCSV("data16.csv")
+	require.NoError(err)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportCSV_DryRun_Success() {
+	require := suite.Require()
+	expectedRejected := []RejectedRow{
+		{Line: 4, Record: []string{"test", "test", "test", "test", "test", "test", "test"}, Reason: "invalid ip"},
+	}
+
+	err := createCSV([][]string{
+		{"ip_address", "country_code", "country", "city", "latitude", "longitude", "mystery_value"},
+		{"127.0.0.1", "US", "test", "test", "48.92021642445653", "14.900399560492929", "2147483647"},
+		{"127.0.0.2", "GB", "test", "test", "48.92021642545653", "14.900399560892929", "2147493647"},
+		{"test", "test", "test", "test", "test", "test", "test"}},
+		"data17.csv")
+	require.NoError(err)
+
+	// A dry run needs no database, so nothing is expected on the mock either.
+	var rejected []RejectedRow
+	result, err := new(Geo).ImportCSVContext(context.Background(), "data17.csv", &ImportOptions{
+		DryRun: true,
+		OnReject: func(row RejectedRow) {
+			rejected = append(rejected, row)
+		},
+	})
+	require.NoError(err)
+	require.Equal(int64(2), result.AcceptedRows)
+	require.Equal(int64(1), result.DiscardedRows)
+	require.Equal(map[string]int64{"invalid ip": 1}, result.Rejected)
+	require.Equal(expectedRejected, rejected)
+
+	_, err = os.Stat("../data17_sanitized.csv")
+	require.True(os.IsNotExist(err))
+
+	err = deleteCSV("data17.csv")
+	require.NoError(err)
+}
+
+func (suite *GeoTestSuite) TestGeo_ImportReader_NoHeader_Success() {
+	require := suite.Require()
+	expectedRejected := []RejectedRow{
+		{Line: 2, Record: []string{"127.0.0.2", "GB"}, Reason: "wrong number of fields"},
+	}
+
+	// The last column of the first row is ignored.
+	data := "2147483647,14.900399560492929,48.92021642445653,test,test,US,127.0.0.1,ignored\n" +
+		"127.0.0.2,GB\n"
+
+	var rejected []RejectedRow
+	result, err := new(Geo).ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		DryRun: true,
+		Columns: &ColumnMapping{NoHeader: true, Indexes: map[string]int{
+			"ip_address": 6, "country_code": 5, "country": 4, "city": 3, "latitude": 2, "longitude": 1, "mystery_value": 0,
+		}},
+		OnReject: func(row RejectedRow) {
+			rejected = append(rejected, row)
+		},
+	})
+	require.NoError(err)
+	require.Equal(int64(2), result.TotalRows)
+	require.Equal(int64(1), result.AcceptedRows)
+	require.Equal(int64(1), result.ParseErrors)
+	require.Equal(expectedRejected, rejected)
+}
+
 func TestGeo(t *testing.T) {
 	suite.Run(t, new(GeoTestSuite))
 }
@@ -0,0 +1,219 @@
+package geoolocation
+
+import (
+	_ "embed"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// ipv4Special is the IANA IPv4 special-purpose address registry, with the multicast
+// block, and the category of every block.
+//
+//go:embed data/iana-ipv4-special.csv
+var ipv4Special string
+
+// ipv6Special is the IANA IPv6 special-purpose address registry, with the multicast
+// block and the blocks the IPv6 address space registry reserves, and the category of
+// every block.
+//
+//go:embed data/iana-ipv6-special.csv
+var ipv6Special string
+
+// IPCategory is a category of the special-purpose addresses, see IPCategoryRules.
+type IPCategory string
+
+// The categories of the special-purpose addresses.
+const (
+	// IPUnspecified is 0.0.0.0 and ::.
+	IPUnspecified IPCategory = "unspecified"
+
+	// IPLoopback is 127.0.0.0/8 and ::1.
+	IPLoopback IPCategory = "loopback"
+
+	// IPPrivate is the RFC 1918 private-use blocks and the IPv6 unique-local block.
+	IPPrivate IPCategory = "private"
+
+	// IPShared is the carrier-grade NAT block, 100.64.0.0/10.
+	IPShared IPCategory = "shared"
+
+	// IPLinkLocal is 169.254.0.0/16 and fe80::/10.
+	IPLinkLocal IPCategory = "link-local"
+
+	// IPDocumentation is the TEST-NET blocks and the IPv6 documentation blocks.
+	IPDocumentation IPCategory = "documentation"
+
+	// IPBenchmarking is 198.18.0.0/15 and 2001:2::/48.
+	IPBenchmarking IPCategory = "benchmarking"
+
+	// IPMulticast is 224.0.0.0/4 and ff00::/8.
+	IPMulticast IPCategory = "multicast"
+
+	// IPProtocol is the blocks assigned to protocols, such as anycast services,
+	// AS112 or ORCHID.
+	IPProtocol IPCategory = "protocol"
+
+	// IPTranslation is the IPv4-mapped, NAT64, Teredo and 6to4 blocks.
+	IPTranslation IPCategory = "translation"
+
+	// IPReserved is the reserved blocks, such as 240.0.0.0/4, the limited broadcast
+	// address and the unallocated IPv6 space.
+	IPReserved IPCategory = "reserved"
+)
+
+// ipCategories are the categories in order.
+var ipCategories = []IPCategory{
+	IPUnspecified, IPLoopback, IPPrivate, IPShared, IPLinkLocal, IPDocumentation,
+	IPBenchmarking, IPMulticast, IPProtocol, IPTranslation, IPReserved,
+}
+
+// ipBlock is a block of the special-purpose registries.
+type ipBlock struct {
+	prefix   netip.Prefix
+	name     string
+	category IPCategory
+}
+
+// ipBlocks maps the prefixes of the special-purpose registries to their blocks.
+var ipBlocks = make(map[netip.Prefix]*ipBlock)
+
+// ipBlockBits are the lengths of the prefixes of ipBlocks, the longest first.
+var ipBlockBits []int
+
+func init() {
+	categories := make(map[IPCategory]bool, len(ipCategories))
+	for _, category := range ipCategories {
+		categories[category] = true
+	}
+
+	lengths := make(map[int]bool)
+	for _, table := range []string{ipv4Special, ipv6Special} {
+		for _, record := range readTable(table) {
+			prefix, err := netip.ParsePrefix(record[0])
+			if err != nil {
+				panic(fmt.Sprintf("invalid address block: %v", err))
+			}
+
+			category := IPCategory(record[3])
+			if !categories[category] {
+				panic(fmt.Sprintf("invalid category of %s: %s", record[0], category))
+			}
+
+			prefix = prefix.Masked()
+			ipBlocks[prefix] = &ipBlock{prefix: prefix, name: record[1], category: category}
+			lengths[prefix.Bits()] = true
+		}
+	}
+
+	for bits := range lengths {
+		ipBlockBits = append(ipBlockBits, bits)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ipBlockBits)))
+}
+
+// lookupIP returns the most specific special-purpose block of the address, nil if
+// there is none.
+func lookupIP(addr netip.Addr) *ipBlock {
+	for _, bits := range ipBlockBits {
+		if bits > addr.BitLen() {
+			continue
+		}
+
+		prefix, _ := addr.Prefix(bits)
+		if block, ok := ipBlocks[prefix]; ok {
+			return block
+		}
+	}
+
+	return nil
+}
+
+// classifyIP returns the special-purpose blocks of the address: its most specific
+// block, and for an IPv4-mapped address, the most specific block of the IPv4 address
+// too.
+func classifyIP(ip string) ([]*ipBlock, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	addr = addr.WithZone("")
+
+	var blocks []*ipBlock
+	if block := lookupIP(addr); block != nil {
+		blocks = append(blocks, block)
+	}
+
+	if addr.Is4In6() {
+		if block := lookupIP(addr.Unmap()); block != nil {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return blocks, nil
+}
+
+// ipClass is the classification of an address by classifyIP.
+type ipClass struct {
+	ip     string
+	blocks []*ipBlock
+	err    error
+}
+
+// specialBlocks returns the special-purpose blocks of the ip address of the row. They
+// are classified once for all the rules of IPCategoryRules, unless a rule changes the
+// address.
+func (row *Row) specialBlocks() ([]*ipBlock, error) {
+	if row.ipClass == nil || row.ipClass.ip != row.IPAddress {
+		blocks, err := classifyIP(row.IPAddress)
+		row.ipClass = &ipClass{ip: row.IPAddress, blocks: blocks, err: err}
+	}
+
+	return row.ipClass.blocks, row.ipClass.err
+}
+
+// IPCategoryRuleName returns the name of the rule of the category, e.g. "private ip",
+// so the rows it rejects are counted as "invalid private ip".
+func IPCategoryRuleName(category IPCategory) string {
+	return string(category) + " ip"
+}
+
+// IPCategoryRules returns the rules that reject the special-purpose addresses, one
+// for every category but the allowed ones, named by IPCategoryRuleName. The blocks
+// are embedded from the IANA special-purpose address registries, and an address is
+// in the category of the most specific block it falls in, e.g. ::1 is loopback
+// rather than reserved. An IPv4-mapped IPv6 address is in the translation category
+// and in the category of its IPv4 address, so ::ffff:127.0.0.1 is rejected as
+// loopback even if translation is allowed. The rules aren't default rules:
+//
+//	AddRules: IPCategoryRules(IPPrivate, IPShared)
+func IPCategoryRules(allowed ...IPCategory) []Rule {
+	skip := make(map[IPCategory]bool, len(allowed))
+	for _, category := range allowed {
+		skip[category] = true
+	}
+
+	var rules []Rule
+	for _, category := range ipCategories {
+		if skip[category] {
+			continue
+		}
+
+		category := category
+		rules = append(rules, NewRule(IPCategoryRuleName(category), func(row *Row) error {
+			blocks, err := row.specialBlocks()
+			if err != nil {
+				return err
+			}
+
+			for _, block := range blocks {
+				if block.category == category {
+					return fmt.Errorf("%s is in %s, %s", row.IPAddress, block.prefix, block.name)
+				}
+			}
+
+			return nil
+		}))
+	}
+
+	return rules
+}
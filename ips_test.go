@@ -0,0 +1,127 @@
+package geoolocation
+
+import (
+	"context"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type IPsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *IPsTestSuite) TestIPs_classifyIP() {
+	require := suite.Require()
+
+	tests := []struct {
+		ip         string
+		categories []IPCategory
+	}{
+		{"0.0.0.0", []IPCategory{IPUnspecified}},
+		{"0.1.2.3", []IPCategory{IPReserved}},
+		{"10.1.2.3", []IPCategory{IPPrivate}},
+		{"172.31.255.255", []IPCategory{IPPrivate}},
+		{"172.32.0.1", nil},
+		{"192.168.1.1", []IPCategory{IPPrivate}},
+		{"100.64.0.1", []IPCategory{IPShared}},
+		{"127.0.0.1", []IPCategory{IPLoopback}},
+		{"169.254.10.10", []IPCategory{IPLinkLocal}},
+		{"192.0.2.1", []IPCategory{IPDocumentation}},
+		{"203.0.113.9", []IPCategory{IPDocumentation}},
+		{"198.19.0.1", []IPCategory{IPBenchmarking}},
+		{"192.0.0.9", []IPCategory{IPProtocol}},
+		{"224.0.0.251", []IPCategory{IPMulticast}},
+		{"240.0.0.1", []IPCategory{IPReserved}},
+		{"255.255.255.255", []IPCategory{IPReserved}},
+		{"8.8.8.8", nil},
+		{"::", []IPCategory{IPUnspecified}},
+		{"::1", []IPCategory{IPLoopback}},
+		{"::ffff:10.1.2.3", []IPCategory{IPTranslation, IPPrivate}},
+		{"::ffff:127.0.0.1", []IPCategory{IPTranslation, IPLoopback}},
+		{"::ffff:8.8.8.8", []IPCategory{IPTranslation}},
+		{"fd00::1", []IPCategory{IPPrivate}},
+		{"fe80::1%eth0", []IPCategory{IPLinkLocal}},
+		{"fec0::1", []IPCategory{IPReserved}},
+		{"2001:db8::1", []IPCategory{IPDocumentation}},
+		{"2001::1", []IPCategory{IPTranslation}},
+		{"2001:1::1", []IPCategory{IPProtocol}},
+		{"ff02::1", []IPCategory{IPMulticast}},
+		{"4000::1", []IPCategory{IPReserved}},
+		{"2a00:1450:4001::1", nil},
+	}
+
+	for _, t := range tests {
+		suite.Run(t.ip, func() {
+			blocks, err := classifyIP(t.ip)
+			require.NoError(err)
+
+			var categories []IPCategory
+			for _, block := range blocks {
+				categories = append(categories, block.category)
+			}
+			require.Equal(t.categories, categories)
+		})
+	}
+
+	_, err := classifyIP("test")
+	require.Error(err)
+}
+
+func (suite *IPsTestSuite) TestIPs_IPCategoryRules() {
+	require := suite.Require()
+
+	rules := IPCategoryRules(IPPrivate, IPShared)
+	require.Len(rules, len(ipCategories)-2)
+	require.NotContains(ruleNames(rules), "private ip")
+	require.Contains(ruleNames(rules), "loopback ip")
+
+	validate := func(ip string) error {
+		for _, rule := range rules {
+			if err := rule.Validate(&Row{IPAddress: ip}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	require.NoError(validate("10.1.2.3"))
+	require.NoError(validate("100.64.0.1"))
+	require.NoError(validate("8.8.8.8"))
+	require.EqualError(validate("127.0.0.1"), "127.0.0.1 is in 127.0.0.0/8, Loopback")
+	require.EqualError(validate("::ffff:127.0.0.1"), "::ffff:127.0.0.1 is in 127.0.0.0/8, Loopback")
+	require.EqualError(validate("::ffff:8.8.8.8"), "::ffff:8.8.8.8 is in ::ffff:0.0.0.0/96, IPv4-mapped Address")
+	require.Error(validate("test"))
+
+	rules = IPCategoryRules(IPTranslation)
+	require.NoError(validate("::ffff:8.8.8.8"))
+	require.EqualError(validate("::ffff:10.1.2.3"), "::ffff:10.1.2.3 is in 10.0.0.0/8, Private-Use")
+}
+
+func (suite *IPsTestSuite) TestIPs_ImportReader_Success() {
+	require := suite.Require()
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"200.106.141.15,SI,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346\n" +
+		"10.0.0.1,CZ,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346\n" +
+		"127.0.0.1,CZ,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346\n" +
+		"2001:db8::1,CZ,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346\n" +
+		"224.0.0.1,CZ,Nepal,DuBuquemouth,-84.87503094689836,7.206435933364332,7823011346\n"
+
+	result, err := new(Geo).ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		DryRun:   true,
+		AddRules: IPCategoryRules(IPPrivate),
+	})
+	require.NoError(err)
+	require.Equal(int64(2), result.AcceptedRows)
+	require.Equal(map[string]int64{
+		"invalid loopback ip":      1,
+		"invalid documentation ip": 1,
+		"invalid multicast ip":     1,
+	}, result.Rejected)
+}
+
+func TestIPs(t *testing.T) {
+	suite.Run(t, new(IPsTestSuite))
+}
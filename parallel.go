@@ -0,0 +1,284 @@
+package geoolocation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// parallelReadMinSize is the least size of a file read in parallel, smaller files
+// aren't worth splitting.
+var parallelReadMinSize int64 = 64 << 20
+
+// sourceRange is a range of the source starting on a record boundary.
+type sourceRange struct {
+	start, end int64
+
+	// The line of the source the range starts on.
+	line int64
+}
+
+// parallelSource returns the source to be read in parallel, if it's a large enough
+// uncompressed file and the import isn't checkpointed. Upserts and deltas are never
+// read in parallel, as the rows are numbered in the order they are read.
+func (i *csvImporter) parallelSource() (io.ReaderAt, int64, bool) {
+	if i.readConcurrency <= 1 || i.checkpoint != nil || i.ordered() || compressionByExt(i.path) != compressionNone {
+		return nil, 0, false
+	}
+
+	ra, size, ok := randomAccess(i.source)
+	if !ok || size < parallelReadMinSize {
+		return nil, 0, false
+	}
+
+	head := make([]byte, len(zipMagic))
+	if _, err := ra.ReadAt(head, 0); err != nil || compressionByMagic(head) != compressionNone {
+		return nil, 0, false
+	}
+
+	// The record boundaries are found byte by byte.
+	d := i.csvDialect()
+	if d.Comma >= utf8.RuneSelf || d.Comment >= utf8.RuneSelf {
+		return nil, 0, false
+	}
+
+	return ra, size, true
+}
+
+// csvDialect returns the dialect of the source with the delimiter resolved.
+func (i *csvImporter) csvDialect() Dialect {
+	var d Dialect
+	if i.dialect != nil {
+		d = *i.dialect
+	}
+
+	switch {
+	case d.Comma != 0:
+	case dataExt(i.path) == ".tsv":
+		d.Comma = '\t'
+	default:
+		d.Comma = ','
+	}
+
+	return d
+}
+
+// readParallel splits the file into readConcurrency ranges aligned on record
+// boundaries and reads them concurrently, like read does. The rows are sent in no
+// particular order, but with their lines in the file.
+func (i *csvImporter) readParallel(ctx context.Context, ra io.ReaderAt, size int64) (int64, error) {
+	d := i.csvDialect()
+
+	var start int64
+	if d.StripBOM {
+		head := make([]byte, len(utf8BOM))
+		if _, err := ra.ReadAt(head, 0); err == nil && bytes.Equal(head, utf8BOM) {
+			start = int64(len(utf8BOM))
+		}
+		d.StripBOM = false
+	}
+
+	reader := newCSVReader(io.NewSectionReader(ra, start, size-start), i.path, &d)
+
+	var header []string
+	if i.columns == nil || !i.columns.NoHeader {
+		var err error
+		header, err = reader.Read()
+		if err != nil {
+			return 0, errors.New("error reading csv header")
+		}
+	}
+
+	columns, err := resolveColumns(header, i.fields(), i.columns)
+	if err != nil {
+		return 0, err
+	}
+
+	// Every range reader must expect the number of fields the first record sets.
+	if d.FieldsPerRecord == 0 {
+		if header == nil {
+			if record, err := reader.Read(); err == nil {
+				d.FieldsPerRecord = len(record)
+			}
+		} else {
+			d.FieldsPerRecord = len(header)
+		}
+	}
+
+	line := int64(1)
+	if header != nil {
+		skipped := make([]byte, reader.InputOffset())
+		if _, err := ra.ReadAt(skipped, start); err != nil {
+			return 0, err
+		}
+
+		start += int64(len(skipped))
+		line += int64(bytes.Count(skipped, []byte{'\n'}))
+	}
+
+	ranges, err := splitSource(uncounted(ra), start, size, line, i.readConcurrency, &d)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var totalRows atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ranges))
+	for _, r := range ranges {
+		wg.Add(1)
+		go func(r sourceRange) {
+			defer wg.Done()
+
+			reader := newCSVReader(io.NewSectionReader(ra, r.start, r.end-r.start), i.path, &d)
+			for ctx.Err() == nil {
+				record, err := reader.Read()
+				if err == io.EOF {
+					return
+				}
+
+				totalRows.Add(1)
+				if _, err := i.sendRecord(ctx, reader, record, err, columns, r.line-1); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	// The first error is the reason of the cancellation.
+	select {
+	case err := <-errs:
+		return totalRows.Load(), err
+	default:
+	}
+
+	return totalRows.Load(), ctx.Err()
+}
+
+// uncounted returns the file under the counting reader of the import, so finding the
+// record boundaries doesn't count as progress.
+func uncounted(ra io.ReaderAt) io.ReaderAt {
+	if c, ok := ra.(*countingReader); ok {
+		if raw, ok := c.r.(io.ReaderAt); ok {
+			return raw
+		}
+	}
+
+	return ra
+}
+
+// The states of splitSource.
+const (
+	scanLineStart = iota
+	scanFieldStart
+	scanUnquoted
+	scanQuoted
+	scanQuote
+	scanSkipLine
+)
+
+// splitSource splits the records from start to size into at most n ranges of about
+// the same size, starting on the line. The source is scanned the way encoding/csv
+// parses it, so a range never starts inside a quoted field spanning lines.
+func splitSource(ra io.ReaderAt, start int64, size int64, line int64, n int, d *Dialect) ([]sourceRange, error) {
+	ranges := []sourceRange{{start: start, line: line}}
+	step := (size - start) / int64(n)
+	target := start + step
+
+	comma, comment := byte(d.Comma), byte(d.Comment)
+	state := scanLineStart
+	buf := make([]byte, 64<<10)
+	offset := start
+	for offset < size && len(ranges) < n {
+		read, err := ra.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if read == 0 {
+			break
+		}
+
+		for _, b := range buf[:read] {
+			offset++
+
+			if state == scanLineStart {
+				state = scanFieldStart
+				if comment != 0 && b == comment {
+					state = scanSkipLine
+					continue
+				}
+			}
+
+			switch state {
+			case scanFieldStart:
+				switch {
+				case d.TrimLeadingSpace && (b == ' ' || b == '\t'):
+				case b == '"':
+					state = scanQuoted
+				case b == comma:
+				case b == '\n':
+					state = scanLineStart
+				default:
+					state = scanUnquoted
+				}
+			case scanUnquoted:
+				switch b {
+				case comma:
+					state = scanFieldStart
+				case '\n':
+					state = scanLineStart
+				}
+			case scanQuoted:
+				if b == '"' {
+					state = scanQuote
+				}
+			case scanQuote:
+				switch {
+				case b == '"':
+					state = scanQuoted
+				case b == comma:
+					state = scanFieldStart
+				case b == '\n':
+					state = scanLineStart
+				case b == '\r':
+				case d.LazyQuotes:
+					state = scanQuoted
+				default:
+					// encoding/csv rejects the record at the end of the line.
+					state = scanSkipLine
+				}
+			case scanSkipLine:
+				if b == '\n' {
+					state = scanLineStart
+				}
+			}
+
+			if b != '\n' {
+				continue
+			}
+			line++
+
+			if state == scanLineStart && offset >= target && offset < size {
+				ranges[len(ranges)-1].end = offset
+				ranges = append(ranges, sourceRange{start: offset, line: line})
+				target = offset + step
+				if len(ranges) == n {
+					break
+				}
+			}
+		}
+	}
+
+	ranges[len(ranges)-1].end = size
+
+	return ranges, nil
+}
@@ -0,0 +1,207 @@
+package geoolocation
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/suite"
+	"github.com/zeynab-sb/geoolocation/database"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type ParallelTestSuite struct {
+	suite.Suite
+	minSize int64
+}
+
+func (suite *ParallelTestSuite) SetupTest() {
+	suite.minSize = parallelReadMinSize
+	parallelReadMinSize = 0
+}
+
+func (suite *ParallelTestSuite) TearDownTest() {
+	parallelReadMinSize = suite.minSize
+}
+
+// parallelTestSource returns a source of n rows with a quoted city spanning two
+// lines every 7th row, an invalid ip every 5th row and a missing field every 11th row.
+func parallelTestSource(n int) string {
+	var source strings.Builder
+	source.WriteString("ip_address,country_code,country,city,latitude,longitude,mystery_value\n")
+	for j := 1; j <= n; j++ {
+		ip := fmt.Sprintf("10.0.%d.%d", j/256, j%256)
+		if j%5 == 0 {
+			ip = "test"
+		}
+
+		city := "test"
+		if j%7 == 0 {
+			city = "\"New\nYork, \"\"NY\"\"\""
+		}
+
+		if j%11 == 0 {
+			source.WriteString(ip + ",US,test," + city + ",48.92021642445653,14.900399560492929\n")
+			continue
+		}
+		source.WriteString(ip + ",US,test," + city + ",48.92021642445653,14.900399560492929,2147483647\n")
+	}
+
+	return source.String()
+}
+
+// readAll reads the file like an import with the read concurrency, and returns the
+// total rows and the rows sent and rejected by line.
+func (suite *ParallelTestSuite) readAll(path string, readConcurrency int) (int64, []csvData, []RejectedRow) {
+	require := suite.Require()
+
+	file, err := os.Open(path)
+	require.NoError(err)
+	defer file.Close()
+
+	var rejected []RejectedRow
+	rejecter, err := newRejecter(nil, func(row RejectedRow) { rejected = append(rejected, row) }, csvHeader, false)
+	require.NoError(err)
+
+	i := &csvImporter{
+		path:            path,
+		source:          &countingReader{r: file},
+		readConcurrency: readConcurrency,
+		data:            make(chan csvData, 16),
+		rejecter:        rejecter,
+	}
+
+	done := make(chan []csvData)
+	go func() {
+		var rows []csvData
+		for d := range i.data {
+			rows = append(rows, d)
+		}
+		done <- rows
+	}()
+
+	total, err := i.read(context.Background())
+	require.NoError(err)
+	rows := <-done
+
+	// The rows are numbered in the order they are read, which the parallel reads don't keep.
+	sort.Slice(rows, func(a, b int) bool { return rows[a].line < rows[b].line })
+	for j := range rows {
+		rows[j].row = 0
+	}
+	sort.Slice(rejected, func(a, b int) bool { return rejected[a].Line < rejected[b].Line })
+
+	return total, rows, rejected
+}
+
+func (suite *ParallelTestSuite) TestParallel_read_Success() {
+	require := suite.Require()
+
+	path := filepath.Join(suite.T().TempDir(), "data.csv")
+	require.NoError(os.WriteFile(path, []byte(parallelTestSource(500)), 0o644))
+
+	expectedTotal, expectedRows, expectedRejected := suite.readAll(path, 1)
+	require.Equal(int64(500), expectedTotal)
+	require.NotEmpty(expectedRejected)
+
+	total, rows, rejected := suite.readAll(path, 4)
+	require.Equal(expectedTotal, total)
+	require.Equal(expectedRows, rows)
+	require.Equal(expectedRejected, rejected)
+}
+
+func (suite *ParallelTestSuite) TestParallel_read_NoHeader_Success() {
+	require := suite.Require()
+
+	path := filepath.Join(suite.T().TempDir(), "data.csv")
+	source := strings.SplitN(parallelTestSource(100), "\n", 2)[1]
+	require.NoError(os.WriteFile(path, []byte(source), 0o644))
+
+	file, err := os.Open(path)
+	require.NoError(err)
+	defer file.Close()
+
+	i := &csvImporter{
+		path:            path,
+		source:          file,
+		readConcurrency: 3,
+		data:            make(chan csvData, 100),
+		columns: &ColumnMapping{NoHeader: true, Indexes: map[string]int{
+			"ip_address": 0, "country_code": 1, "country": 2, "city": 3, "latitude": 4, "longitude": 5, "mystery_value": 6,
+		}},
+	}
+
+	total, err := i.read(context.Background())
+	require.NoError(err)
+	require.Equal(int64(100), total)
+
+	var first csvData
+	for d := range i.data {
+		if d.line == 1 {
+			first = d
+		}
+	}
+	require.Equal("10.0.0.1", first.ipAddress)
+}
+
+func (suite *ParallelTestSuite) TestParallel_parallelSource() {
+	require := suite.Require()
+
+	dir := suite.T().TempDir()
+	path := filepath.Join(dir, "data.csv")
+	require.NoError(os.WriteFile(path, []byte(parallelTestSource(10)), 0o644))
+
+	file, err := os.Open(path)
+	require.NoError(err)
+	defer file.Close()
+
+	i := &csvImporter{path: path, source: file, readConcurrency: 2}
+	_, _, ok := i.parallelSource()
+	require.True(ok)
+
+	i.readConcurrency = 1
+	_, _, ok = i.parallelSource()
+	require.False(ok)
+
+	i.readConcurrency = 2
+	i.loadOptions = &database.LoadOptions{Mode: database.ModeUpsert}
+	_, _, ok = i.parallelSource()
+	require.False(ok)
+	i.loadOptions = nil
+
+	i.readConcurrency = 2
+	i.source = strings.NewReader(parallelTestSource(10))
+	_, _, ok = i.parallelSource()
+	require.False(ok)
+
+	gzipPath := filepath.Join(dir, "data.csv.gz")
+	require.NoError(os.WriteFile(gzipPath, gzipMagic, 0o644))
+	gzipFile, err := os.Open(gzipPath)
+	require.NoError(err)
+	defer gzipFile.Close()
+
+	i = &csvImporter{source: gzipFile, readConcurrency: 2}
+	_, _, ok = i.parallelSource()
+	require.False(ok)
+}
+
+func (suite *ParallelTestSuite) TestParallel_splitSource() {
+	require := suite.Require()
+
+	source := "a,b\n\"c\nd\",e\n# \"x\nf,g\nh,i\n"
+	d := &Dialect{Comma: ',', Comment: '#'}
+
+	ranges, err := splitSource(strings.NewReader(source), 0, int64(len(source)), 1, 4, d)
+	require.NoError(err)
+	require.Equal([]sourceRange{
+		{start: 0, end: 12, line: 1},
+		{start: 12, end: 21, line: 4},
+		{start: 21, end: 25, line: 6},
+	}, ranges)
+}
+
+func TestParallel(t *testing.T) {
+	suite.Run(t, new(ParallelTestSuite))
+}
@@ -0,0 +1,199 @@
+package geoolocation
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Phase is the stage an import is in.
+type Phase string
+
+const (
+	// PhaseRead is while the source is being read, the sanitizers run alongside.
+	PhaseRead Phase = "read"
+
+	// PhaseSanitize is while the sanitizers finish the rows already read.
+	PhaseSanitize Phase = "sanitize"
+
+	// PhaseLoad is while the sanitized rows are being loaded to the database.
+	PhaseLoad Phase = "load"
+
+	// PhaseDone is reported once when the import succeeds.
+	PhaseDone Phase = "done"
+)
+
+// defaultProgressInterval is how often the progress is reported if ImportOptions
+// doesn't set it.
+const defaultProgressInterval = time.Second
+
+// Progress is a snapshot of a running import.
+type Progress struct {
+	Phase Phase `json:"phase"`
+
+	// The number of rows read from the source, excluding the header.
+	RowsRead int64 `json:"rows_read"`
+
+	// The number of rows that passed sanitizing.
+	RowsSanitized int64 `json:"rows_sanitized"`
+
+	// The number of rows rejected, either by parsing or by sanitizing.
+	RowsRejected int64 `json:"rows_rejected"`
+
+	// The number of bytes consumed from the source. For compressed sources it
+	// counts the compressed bytes.
+	BytesRead int64 `json:"bytes_read"`
+
+	// The size of the source in bytes, 0 when it isn't known, e.g. for a pipe.
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// progressReporter calls the progress callback of the import periodically and
+// whenever the phase changes. The callback is only called from its own go routine.
+type progressReporter struct {
+	callback   func(Progress)
+	interval   time.Duration
+	stats      *importStats
+	source     *countingReader
+	totalBytes int64
+
+	phases chan Phase
+	done   chan struct{}
+}
+
+// newProgressReporter returns nil when there is no callback.
+func newProgressReporter(callback func(Progress), interval time.Duration, stats *importStats, source *countingReader, totalBytes int64) *progressReporter {
+	if callback == nil {
+		return nil
+	}
+
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+
+	return &progressReporter{
+		callback:   callback,
+		interval:   interval,
+		stats:      stats,
+		source:     source,
+		totalBytes: totalBytes,
+		phases:     make(chan Phase),
+		done:       make(chan struct{}),
+	}
+}
+
+// start reports the read phase and keeps reporting until stop is called.
+func (p *progressReporter) start() {
+	if p == nil {
+		return
+	}
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		phase := PhaseRead
+		p.report(phase)
+		for {
+			select {
+			case next, ok := <-p.phases:
+				if !ok {
+					return
+				}
+
+				phase = next
+				p.report(phase)
+			case <-ticker.C:
+				p.report(phase)
+			}
+		}
+	}()
+}
+
+// setPhase reports the new phase immediately.
+func (p *progressReporter) setPhase(phase Phase) {
+	if p == nil {
+		return
+	}
+
+	p.phases <- phase
+}
+
+// stop stops reporting and waits for the running callback to return.
+func (p *progressReporter) stop() {
+	if p == nil {
+		return
+	}
+
+	close(p.phases)
+	<-p.done
+}
+
+func (p *progressReporter) report(phase Phase) {
+	p.callback(Progress{
+		Phase:         phase,
+		RowsRead:      p.stats.read.Load(),
+		RowsSanitized: p.stats.sanitized.Load(),
+		RowsRejected:  p.stats.parseErrors.Load() + p.stats.rejectedRows.Load(),
+		BytesRead:     p.source.n.Load(),
+		TotalBytes:    p.totalBytes,
+	})
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+
+	return n, err
+}
+
+// ReadAt is used to read zip archives, it fails if the underlying reader has no
+// random access.
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	ra, ok := c.r.(io.ReaderAt)
+	if !ok {
+		return 0, errors.New("source doesn't support random access")
+	}
+
+	n, err := ra.ReadAt(p, off)
+	c.n.Add(int64(n))
+
+	return n, err
+}
+
+// sourceSize returns the size of the source in bytes, 0 when it isn't known.
+func sourceSize(source io.Reader) int64 {
+	switch s := source.(type) {
+	case *os.File:
+		if info, err := s.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	case interface{ Size() int64 }:
+		return s.Size()
+	}
+
+	return 0
+}
+
+// filesSize returns the total size of the files, counting the ones that can't be
+// stated as empty.
+func filesSize(paths []string) int64 {
+	var size int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+
+	return size
+}
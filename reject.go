@@ -0,0 +1,97 @@
+package geoolocation
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// RejectedRow is a row of the source that is not imported.
+type RejectedRow struct {
+	// The line of the source the row starts on.
+	Line int64 `json:"line"`
+
+	// The original fields of the row.
+	Record []string `json:"record"`
+
+	// Why the row is rejected, e.g. "invalid ip" or "wrong number of fields".
+	Reason string `json:"reason"`
+
+	// The file of the row when several files are imported by Geo.ImportFiles.
+	File string `json:"file,omitempty"`
+}
+
+// rejecter reports rejected rows to the reject writer and callback of the import.
+type rejecter struct {
+	m        sync.Mutex
+	writer   *csv.Writer
+	callback func(RejectedRow)
+
+	// Writes the file of the rows to the reject CSV.
+	files bool
+}
+
+// newRejecter returns nil when there is nowhere to report rejected rows. If w is
+// not nil, the header of the reject CSV, made of the fields, is written to it. With
+// files, the reject CSV has a file column before the line.
+func newRejecter(w io.Writer, callback func(RejectedRow), fields []string, files bool) (*rejecter, error) {
+	if w == nil && callback == nil {
+		return nil, nil
+	}
+
+	r := &rejecter{callback: callback, files: files}
+	if w != nil {
+		header := append([]string{}, fields...)
+		if files {
+			header = append(header, "file")
+		}
+
+		r.writer = csv.NewWriter(w)
+		if err := r.writer.Write(append(header, "line", "reason")); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// reject reports the row. It is safe to be called concurrently, and the callback is
+// never called concurrently.
+func (r *rejecter) reject(row RejectedRow) error {
+	if r == nil {
+		return nil
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.callback != nil {
+		r.callback(row)
+	}
+
+	if r.writer != nil {
+		record := append([]string{}, row.Record...)
+		if r.files {
+			record = append(record, row.File)
+		}
+
+		return r.writer.Write(append(record, strconv.FormatInt(row.Line, 10), row.Reason))
+	}
+
+	return nil
+}
+
+// flush writes any buffered rejected rows to the reject writer.
+func (r *rejecter) flush() error {
+	if r == nil || r.writer == nil {
+		return nil
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.writer.Flush()
+
+	return r.writer.Error()
+}
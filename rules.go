@@ -0,0 +1,251 @@
+package geoolocation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Row is a row of the source checked by the rules. The rules may normalize its
+// fields, and the row is loaded as they leave it.
+type Row struct {
+	// The line of the source the row starts on.
+	Line int64
+
+	IPAddress    string
+	CountryCode  string
+	Country      string
+	City         string
+	Latitude     string
+	Longitude    string
+	MysteryValue string
+
+	// The special-purpose blocks of IPAddress, see specialBlocks.
+	ipClass *ipClass
+}
+
+// Rule is a check of the rows. A row is rejected by the first rule it fails, with
+// "invalid " followed by the name of the rule as the reason, e.g. "invalid ip".
+type Rule interface {
+	// Name identifies the rule in ImportOptions and in the rejection reasons.
+	Name() string
+
+	// Validate returns an error if the row must be rejected, or an error wrapped by
+	// Flag to flag it. The error of a rejection is only logged at the debug level,
+	// the reason of the rejection is made of the name. The fields of an accepted
+	// row must be loadable into the columns of locations, so a rule accepting more
+	// than the default rules must normalize what it accepts, e.g. truncate a float
+	// mystery value to an integer.
+	Validate(row *Row) error
+}
+
+// FlaggedRow is a row flagged by a rule. It's loaded nonetheless.
+type FlaggedRow struct {
+	// The line of the source the row starts on.
+	Line int64 `json:"line"`
+
+	// The fields of the row as they were read.
+	Record []string `json:"record"`
+
+	// The name of the rule flagging the row.
+	Rule string `json:"rule"`
+
+	// The error of the rule.
+	Reason string `json:"reason"`
+
+	// The file of the row when several files are imported by Geo.ImportFiles.
+	File string `json:"file,omitempty"`
+}
+
+// flagError is the error of a rule flagging a row.
+type flagError struct {
+	err error
+}
+
+func (e *flagError) Error() string {
+	return e.err.Error()
+}
+
+func (e *flagError) Unwrap() error {
+	return e.err
+}
+
+// Flag wraps the error of a rule to flag the row instead of rejecting it. The next
+// rules still validate the row, and the flagged rows are counted in Result.Flagged
+// by rule and reported to ImportOptions.OnFlag.
+func Flag(err error) error {
+	return &flagError{err: err}
+}
+
+// NewRule returns a rule validating the rows by the function.
+func NewRule(name string, validate func(row *Row) error) Rule {
+	return &ruleFunc{name: name, validate: validate}
+}
+
+type ruleFunc struct {
+	name     string
+	validate func(row *Row) error
+}
+
+func (r *ruleFunc) Name() string {
+	return r.name
+}
+
+func (r *ruleFunc) Validate(row *Row) error {
+	return r.validate(row)
+}
+
+// The names of the default rules.
+const (
+	RuleIP           = "ip"
+	RuleCountryCode  = "country code"
+	RuleCountry      = "country"
+	RuleCity         = "city"
+	RuleLatitude     = "latitude"
+	RuleLongitude    = "longitude"
+	RuleMysteryValue = "mystery value"
+)
+
+// defaultRules are the rules of the imports that don't configure theirs.
+var defaultRules = DefaultRules()
+
+// DefaultRules returns the rules the rows are validated by, in order, unless
+// ImportOptions sets others:
+//   - ip: the ip address is an IPv4 or IPv6 address.
+//   - country code: the country code is an ISO 3166-1 alpha-2 code, see
+//     CountryCodeRule.
+//   - country and city: they don't contain SQL commands. A name with a quote is
+//     quoted.
+//   - latitude and longitude: they're numbers within -90 to 90 and -180 to 180.
+//   - mystery value: it's an integer.
+func DefaultRules() []Rule {
+	return []Rule{
+		NewRule(RuleIP, func(row *Row) error {
+			if net.ParseIP(row.IPAddress) == nil {
+				return fmt.Errorf("%q is not an ip address", row.IPAddress)
+			}
+
+			return nil
+		}),
+		CountryCodeRule(),
+		NewRule(RuleCountry, func(row *Row) error {
+			return sanitizeName(&row.Country)
+		}),
+		NewRule(RuleCity, func(row *Row) error {
+			return sanitizeName(&row.City)
+		}),
+		NewRule(RuleLatitude, func(row *Row) error {
+			return checkCoordinate(row.Latitude, 90)
+		}),
+		NewRule(RuleLongitude, func(row *Row) error {
+			return checkCoordinate(row.Longitude, 180)
+		}),
+		NewRule(RuleMysteryValue, func(row *Row) error {
+			_, err := strconv.ParseInt(row.MysteryValue, 10, 64)
+			return err
+		}),
+	}
+}
+
+// sanitizeName rejects a name containing SQL commands and quotes a name with a quote.
+func sanitizeName(name *string) error {
+	if sqlPatternRegex.MatchString(*name) {
+		return fmt.Errorf("%q contains sql", *name)
+	}
+
+	if strings.Contains(*name, "'") {
+		*name = fmt.Sprintf("'%s'", *name)
+	}
+
+	return nil
+}
+
+// checkCoordinate checks the coordinate is a number within -limit to limit.
+func checkCoordinate(coordinate string, limit float64) error {
+	f, err := strconv.ParseFloat(coordinate, 64)
+	if err != nil {
+		return err
+	}
+
+	if !(-limit <= f && f <= limit) {
+		return fmt.Errorf("%v is out of range", f)
+	}
+
+	return nil
+}
+
+// resolveRules returns the rules of the import: Rules, or the default rules, with
+// AddRules and without DisableRules.
+func resolveRules(opts *ImportOptions) ([]Rule, error) {
+	rules := opts.Rules
+	if rules == nil {
+		rules = defaultRules
+	}
+	rules = append([]Rule{}, rules...)
+
+	for _, rule := range opts.AddRules {
+		if j := ruleIndex(rules, rule.Name()); j >= 0 {
+			rules[j] = rule
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	for _, name := range opts.DisableRules {
+		j := ruleIndex(rules, name)
+		if j < 0 {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules[:j], rules[j+1:]...)
+	}
+
+	return rules, nil
+}
+
+// ruleIndex returns the index of the rule named name, -1 if there is none.
+func ruleIndex(rules []Rule, name string) int {
+	for j, rule := range rules {
+		if rule.Name() == name {
+			return j
+		}
+	}
+
+	return -1
+}
+
+// validate runs the rules on the row, and keeps the fields they normalize. It
+// returns the rules flagging the row, with only the rule and the reason set.
+func (d *csvData) validate(rules []Rule) ([]FlaggedRow, error) {
+	row := Row{
+		Line:         d.line,
+		IPAddress:    d.ipAddress,
+		CountryCode:  d.countryCode,
+		Country:      d.country,
+		City:         d.city,
+		Latitude:     d.latitude,
+		Longitude:    d.longitude,
+		MysteryValue: d.mysteryValue,
+	}
+
+	var flags []FlaggedRow
+	for _, rule := range rules {
+		err := rule.Validate(&row)
+		var flagErr *flagError
+		if errors.As(err, &flagErr) {
+			flags = append(flags, FlaggedRow{Rule: rule.Name(), Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			logrus.Debugf("rule %s failed on line %d: %v", rule.Name(), d.line, err)
+			return nil, errors.New("invalid " + rule.Name())
+		}
+	}
+
+	d.ipAddress, d.countryCode, d.country, d.city = row.IPAddress, row.CountryCode, row.Country, row.City
+	d.latitude, d.longitude, d.mysteryValue = row.Latitude, row.Longitude, row.MysteryValue
+
+	return flags, nil
+}
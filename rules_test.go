@@ -0,0 +1,168 @@
+package geoolocation
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/suite"
+	"github.com/zeynab-sb/geoolocation/database"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type RulesTestSuite struct {
+	suite.Suite
+}
+
+// ruleNames returns the names of the rules in order.
+func ruleNames(rules []Rule) []string {
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name())
+	}
+
+	return names
+}
+
+func (suite *RulesTestSuite) TestRules_resolveRules() {
+	require := suite.Require()
+
+	rules, err := resolveRules(&ImportOptions{})
+	require.NoError(err)
+	require.Equal([]string{"ip", "country code", "country", "city", "latitude", "longitude", "mystery value"}, ruleNames(rules))
+
+	city := NewRule("city", func(row *Row) error { return nil })
+	rules, err = resolveRules(&ImportOptions{
+		AddRules:     []Rule{city, NewRule("non-empty city", func(row *Row) error { return nil })},
+		DisableRules: []string{RuleMysteryValue, RuleCountry},
+	})
+	require.NoError(err)
+	require.Equal([]string{"ip", "country code", "city", "latitude", "longitude", "non-empty city"}, ruleNames(rules))
+	require.Same(city, rules[2])
+
+	// The default rules are left alone.
+	require.Len(defaultRules, 7)
+
+	rules, err = resolveRules(&ImportOptions{Rules: []Rule{city}})
+	require.NoError(err)
+	require.Equal([]string{"city"}, ruleNames(rules))
+
+	_, err = resolveRules(&ImportOptions{DisableRules: []string{"zip"}})
+	require.EqualError(err, `unknown rule "zip"`)
+}
+
+func (suite *RulesTestSuite) TestRules_validate() {
+	require := suite.Require()
+
+	rules := append(DefaultRules(), NewRule("city blocklist", func(row *Row) error {
+		if row.City == "Atlantis" {
+			return errors.New("blocked")
+		}
+
+		return nil
+	}))
+
+	d := csvData{
+		line:         2,
+		ipAddress:    "127.0.0.1",
+		countryCode:  "AT",
+		country:      "te'st",
+		city:         "Atlantis",
+		latitude:     "48.92021642445653",
+		longitude:    "14.900399560492929",
+		mysteryValue: "2147483647",
+	}
+	original := d
+
+	_, err := d.validate(rules)
+	require.Equal(errors.New("invalid city blocklist"), err)
+	// A rejected row isn't normalized.
+	require.Equal(original, d)
+
+	d.city = "Paris"
+	_, err = d.validate(rules)
+	require.NoError(err)
+	require.Equal("'te'st'", d.country)
+}
+
+func (suite *RulesTestSuite) TestRules_ImportReader_Success() {
+	require := suite.Require()
+
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n" +
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647.5\n" +
+		"127.0.0.2,US,test,,48.92021642445653,14.900399560492929,1\n" +
+		"127.0.0.3,ta,test,test,48.92021642445653,14.900399560492929,1\n"
+
+	var rejected []RejectedRow
+	driver := &streamDriver{}
+	result, err := (&Geo{driver: driver}).ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		Stream: true,
+		AddRules: []Rule{
+			NewRule(RuleMysteryValue, func(row *Row) error {
+				f, err := strconv.ParseFloat(row.MysteryValue, 64)
+				if err != nil {
+					return err
+				}
+
+				row.MysteryValue = strconv.FormatInt(int64(f), 10)
+				return nil
+			}),
+			NewRule("non-empty city", func(row *Row) error {
+				if row.City == "" {
+					return errors.New("empty")
+				}
+
+				return nil
+			}),
+		},
+		DisableRules: []string{RuleCountryCode},
+		OnReject: func(row RejectedRow) {
+			rejected = append(rejected, row)
+		},
+	})
+	require.NoError(err)
+	require.Equal(int64(2), result.AcceptedRows)
+	require.Equal(map[string]int64{"invalid non-empty city": 1}, result.Rejected)
+	require.Len(rejected, 1)
+	require.Equal(int64(3), rejected[0].Line)
+
+	// The float mystery value is loaded as an integer.
+	require.Len(driver.records, 2)
+	for _, record := range driver.records {
+		if record[0] == "127.0.0.1" {
+			require.Equal("2147483647", record[6])
+		}
+	}
+}
+
+func (suite *RulesTestSuite) TestRules_ImportReader_Delete_Success() {
+	require := suite.Require()
+
+	// The deletes are only validated by the ip rule, which only accepts IPv4 here.
+	data := "ip_address,country_code,country,city,latitude,longitude,mystery_value,operation\n" +
+		"10.0.0.1,,,,,,,delete\n" +
+		"1.2.3.4,XX,,,0,0,,delete\n" +
+		"10.0.0.2,US,test,test,48.92021642445653,14.900399560492929,1,add\n" +
+		"2001:4860::1,,,,,,,delete\n"
+
+	ipv4 := NewRule(RuleIP, func(row *Row) error {
+		if ip := net.ParseIP(row.IPAddress); ip == nil || ip.To4() == nil {
+			return errors.New("not an IPv4 address")
+		}
+
+		return nil
+	})
+	result, err := new(Geo).ImportReader(context.Background(), strings.NewReader(data), &ImportOptions{
+		DryRun:   true,
+		Mode:     database.ModeDelta,
+		AddRules: append(IPCategoryRules(), ipv4, CoordinatesRule(0.5), NullIslandRule()),
+	})
+	require.NoError(err)
+	require.Equal(int64(2), result.AcceptedRows)
+	require.Equal(map[string]int64{"invalid private ip": 1, "invalid ip": 1}, result.Rejected)
+}
+
+func TestRules(t *testing.T) {
+	suite.Run(t, new(RulesTestSuite))
+}
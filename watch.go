@@ -0,0 +1,255 @@
+package geoolocation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultPollInterval is how often the watched directory is listed if WatchOptions
+// doesn't set it.
+const defaultPollInterval = 10 * time.Second
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// How often the directory is listed, 10 seconds by default.
+	PollInterval time.Duration
+
+	// Where the imported files are moved, the processed directory under the watched
+	// one by default.
+	ProcessedDir string
+
+	// Where the files failed to be imported are moved, the failed directory under
+	// the watched one by default.
+	FailedDir string
+
+	// Import configures the import of every file.
+	Import *ImportOptions
+
+	// OnResult, if not nil, is called with the result of every file once it's moved.
+	OnResult func(WatchResult)
+}
+
+// WatchResult is the outcome of a file imported by Watch. It's also written as JSON
+// next to the moved file, with a .json suffix.
+type WatchResult struct {
+	// The path the file is moved to.
+	Path string `json:"path"`
+
+	// The result of the import, nil if it failed.
+	Result *Result `json:"result,omitempty"`
+
+	// Why the import failed, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// fileState is the size and the modification time of a file seen in the watched
+// directory.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher imports the complete files of a directory.
+type watcher struct {
+	geo  *Geo
+	dir  string
+	opts WatchOptions
+
+	// The files seen in the last poll.
+	seen map[string]fileState
+
+	// The files imported but not moved yet, which are moved again instead of being
+	// imported again as long as they don't change.
+	unmoved map[string]unmovedFile
+}
+
+// unmovedFile is a file imported by Watch that failed to be moved.
+type unmovedFile struct {
+	state  fileState
+	dir    string
+	result WatchResult
+}
+
+// Watch polls the directory until ctx is done, and imports every new file by
+// ImportCSVContext. A file is complete, and imported, once its size and modification
+// time stay the same from one poll to the next, so the files being uploaded are left
+// alone. Hidden files and the files without a valid extension, e.g. data.csv.part,
+// are never imported. An imported file is moved to ProcessedDir, or to FailedDir if
+// the import fails, and its WatchResult is recorded next to it. A file of the same
+// name already there isn't overwritten, the moved file is prefixed with the time
+// instead. A file that can't be moved is moved again by the next polls, without being
+// imported again unless it changes. If ctx is done during an import, the file is left
+// in the directory to be imported again. Watch returns the error of ctx.
+func (g *Geo) Watch(ctx context.Context, dir string, opts *WatchOptions) error {
+	w := &watcher{geo: g, dir: dir, seen: make(map[string]fileState), unmoved: make(map[string]unmovedFile)}
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	if w.opts.PollInterval <= 0 {
+		w.opts.PollInterval = defaultPollInterval
+	}
+	if w.opts.ProcessedDir == "" {
+		w.opts.ProcessedDir = filepath.Join(dir, "processed")
+	}
+	if w.opts.FailedDir == "" {
+		w.opts.FailedDir = filepath.Join(dir, "failed")
+	}
+
+	for _, d := range []string{w.opts.ProcessedDir, w.opts.FailedDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(w.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.poll(ctx); err != nil {
+			// The directory may be unavailable for a while, e.g. on a network mount.
+			logrus.Errorf("error polling %s: %v", dir, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll imports the files of the directory that haven't changed since the last poll.
+func (w *watcher) poll(ctx context.Context) error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]fileState)
+	listed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || !validExtension(name) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// The file is moved or removed since the directory is read.
+			continue
+		}
+
+		listed[name] = true
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if unmoved, ok := w.unmoved[name]; ok {
+			if unmoved.state == state {
+				w.move(name, unmoved)
+				continue
+			}
+
+			// The file is replaced since it's imported.
+			delete(w.unmoved, name)
+		}
+
+		if last, ok := w.seen[name]; !ok || last != state {
+			seen[name] = state
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+
+		w.importFile(ctx, name, state)
+	}
+	w.seen = seen
+
+	for name := range w.unmoved {
+		if !listed[name] {
+			delete(w.unmoved, name)
+		}
+	}
+
+	return nil
+}
+
+// importFile imports the file, moves it and records its result.
+func (w *watcher) importFile(ctx context.Context, name string, state fileState) {
+	path := filepath.Join(w.dir, name)
+
+	started := time.Now()
+	result, err := w.geo.ImportCSVContext(ctx, path, w.opts.Import)
+	if err != nil && ctx.Err() != nil {
+		logrus.Warnf("import of %s interrupted: %v", path, err)
+		return
+	}
+
+	watchResult := WatchResult{Result: result, Started: started, Finished: time.Now()}
+	dir := w.opts.ProcessedDir
+	if err != nil {
+		logrus.Errorf("error importing %s: %v", path, err)
+		watchResult.Error = err.Error()
+		dir = w.opts.FailedDir
+	} else {
+		logrus.Infof("%s imported: %d rows accepted, %d discarded", path, result.AcceptedRows, result.DiscardedRows)
+	}
+
+	w.move(name, unmovedFile{state: state, dir: dir, result: watchResult})
+}
+
+// move moves the imported file and records its result. If the file can't be moved,
+// it's kept in unmoved to be moved by the next poll.
+func (w *watcher) move(name string, file unmovedFile) {
+	path := filepath.Join(w.dir, name)
+
+	var err error
+	file.result.Path, err = moveFile(path, file.dir, file.result.Started)
+	if err != nil {
+		logrus.Errorf("error moving %s: %v", path, err)
+		w.unmoved[name] = file
+		return
+	}
+	delete(w.unmoved, name)
+
+	if err := writeWatchResult(file.result); err != nil {
+		logrus.Errorf("error recording the result of %s: %v", path, err)
+	}
+
+	if w.opts.OnResult != nil {
+		w.opts.OnResult(file.result)
+	}
+}
+
+// moveFile moves the file into the directory, prefixing its name with the time if
+// the directory has a file of the same name. It returns the new path.
+func moveFile(path string, dir string, t time.Time) (string, error) {
+	name := filepath.Base(path)
+	target := filepath.Join(dir, name)
+	if _, err := os.Lstat(target); err == nil {
+		target = filepath.Join(dir, t.Format("20060102T150405.000000000")+"-"+name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	return target, os.Rename(path, target)
+}
+
+// writeWatchResult writes the result as JSON next to the moved file.
+func writeWatchResult(result WatchResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(result.Path+".json", data, 0o644)
+}
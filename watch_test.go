@@ -0,0 +1,183 @@
+package geoolocation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type WatchTestSuite struct {
+	suite.Suite
+	dir     string
+	results []WatchResult
+	watcher *watcher
+}
+
+func (suite *WatchTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+	suite.results = nil
+	suite.watcher = &watcher{
+		geo: new(Geo),
+		dir: suite.dir,
+		opts: WatchOptions{
+			ProcessedDir: filepath.Join(suite.dir, "processed"),
+			FailedDir:    filepath.Join(suite.dir, "failed"),
+			Import:       &ImportOptions{DryRun: true},
+			OnResult: func(result WatchResult) {
+				suite.results = append(suite.results, result)
+			},
+		},
+		seen:    make(map[string]fileState),
+		unmoved: make(map[string]unmovedFile),
+	}
+
+	require := suite.Require()
+	require.NoError(os.Mkdir(suite.watcher.opts.ProcessedDir, 0o755))
+	require.NoError(os.Mkdir(suite.watcher.opts.FailedDir, 0o755))
+}
+
+func (suite *WatchTestSuite) write(name string, data string) {
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, name), []byte(data), 0o644))
+}
+
+func (suite *WatchTestSuite) TestWatch_poll_Success() {
+	require := suite.Require()
+
+	suite.write("data.csv", "ip_address,country_code,country,city,latitude,longitude,mystery_value\n"+
+		"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n"+
+		"test,US,test,test,1,1,1\n")
+	suite.write("data.csv.part", "ip_address")
+	suite.write(".data.csv", "ip_address")
+
+	// The file isn't complete until it's seen unchanged.
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Empty(suite.results)
+
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Len(suite.results, 1)
+
+	result := suite.results[0]
+	require.Equal(filepath.Join(suite.dir, "processed", "data.csv"), result.Path)
+	require.Empty(result.Error)
+	require.Equal(int64(1), result.Result.AcceptedRows)
+	require.Equal(map[string]int64{"invalid ip": 1}, result.Result.Rejected)
+
+	_, err := os.Stat(filepath.Join(suite.dir, "data.csv"))
+	require.True(os.IsNotExist(err))
+
+	data, err := os.ReadFile(result.Path + ".json")
+	require.NoError(err)
+	var recorded WatchResult
+	require.NoError(json.Unmarshal(data, &recorded))
+	require.Equal(result.Path, recorded.Path)
+	require.Equal(result.Result.TotalRows, recorded.Result.TotalRows)
+
+	// The partial and hidden files are left alone.
+	_, err = os.Stat(filepath.Join(suite.dir, "data.csv.part"))
+	require.NoError(err)
+	_, err = os.Stat(filepath.Join(suite.dir, ".data.csv"))
+	require.NoError(err)
+}
+
+func (suite *WatchTestSuite) TestWatch_poll_Growing_Success() {
+	require := suite.Require()
+
+	header := "ip_address,country_code,country,city,latitude,longitude,mystery_value\n"
+	suite.write("data.csv", header)
+	require.NoError(suite.watcher.poll(context.Background()))
+
+	suite.write("data.csv", header+"127.0.0.1,US,test,test,48.92021642445653,14.900399560492929,2147483647\n")
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Empty(suite.results)
+
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Len(suite.results, 1)
+	require.Equal(int64(1), suite.results[0].Result.TotalRows)
+}
+
+func (suite *WatchTestSuite) TestWatch_poll_Failure() {
+	require := suite.Require()
+
+	// A file of the same name failed before.
+	require.NoError(os.WriteFile(filepath.Join(suite.dir, "failed", "data.csv"), nil, 0o644))
+	suite.write("data.csv", "ip,country\n")
+
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Len(suite.results, 1)
+
+	result := suite.results[0]
+	require.Nil(result.Result)
+	require.NotEmpty(result.Error)
+	require.Equal(filepath.Join(suite.dir, "failed"), filepath.Dir(result.Path))
+	require.True(strings.HasSuffix(result.Path, "-data.csv"))
+
+	data, err := os.ReadFile(result.Path)
+	require.NoError(err)
+	require.Equal("ip,country\n", string(data))
+}
+
+func (suite *WatchTestSuite) TestWatch_poll_MoveFailure() {
+	require := suite.Require()
+
+	var rejected int
+	suite.watcher.opts.Import.OnReject = func(row RejectedRow) {
+		rejected++
+	}
+	suite.write("data.csv", "ip_address,country_code,country,city,latitude,longitude,mystery_value\n"+
+		"test,US,test,test,1,1,1\n")
+	require.NoError(os.Remove(suite.watcher.opts.ProcessedDir))
+
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Equal(1, rejected)
+	require.Empty(suite.results)
+
+	// The file isn't imported again while it can't be moved.
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Equal(1, rejected)
+	require.Empty(suite.results)
+
+	require.NoError(os.Mkdir(suite.watcher.opts.ProcessedDir, 0o755))
+	require.NoError(suite.watcher.poll(context.Background()))
+	require.Equal(1, rejected)
+	require.Len(suite.results, 1)
+	require.Equal(filepath.Join(suite.dir, "processed", "data.csv"), suite.results[0].Path)
+	require.Equal(int64(1), suite.results[0].Result.TotalRows)
+	require.Empty(suite.watcher.unmoved)
+}
+
+func (suite *WatchTestSuite) TestWatch_Canceled_Success() {
+	require := suite.Require()
+
+	suite.write("data.csv", "ip_address,country_code,country,city,latitude,longitude,mystery_value\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan WatchResult, 1)
+	errs := make(chan error)
+	go func() {
+		errs <- new(Geo).Watch(ctx, suite.dir, &WatchOptions{
+			PollInterval: 10 * time.Millisecond,
+			Import:       &ImportOptions{DryRun: true},
+			OnResult: func(result WatchResult) {
+				done <- result
+			},
+		})
+	}()
+
+	result := <-done
+	require.Equal(filepath.Join(suite.dir, "processed", "data.csv"), result.Path)
+
+	cancel()
+	require.ErrorIs(<-errs, context.Canceled)
+}
+
+func TestWatch(t *testing.T) {
+	suite.Run(t, new(WatchTestSuite))
+}